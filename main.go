@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -8,19 +9,42 @@ import (
 	"time"
 
 	"github.com/davidw1457/tablo-manager/tablo"
+	"github.com/davidw1457/tablo-manager/tabloapi"
 )
 
-// TODO: Create export function
 // TODO: Cache images. Get from http://privateIP:8885/images/imageID
 
 const userRWX = 0700 // unix-style octal permission
 const loopDelayMinutes = 15
 
+// tabloFlags collects every -tablo given on the command line
+type tabloFlags []tabloapi.TabloDetails
+
+func (f *tabloFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *tabloFlags) Set(value string) error {
+	t, err := tablo.ParseTabloDefinition(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
+
 func main() {
+	discovery := flag.String("discovery", tablo.DiscoverCloud, "how to find tablos: cloud (the Tablo web lookup) or broadcast (UDP broadcast on the local network). the other method is tried if the first finds nothing")
+	var staticTablos tabloFlags
+	flag.Var(&staticTablos, "tablo", "a tablo to use instead of discovery, as ip[,serverID[,name]]. can be given more than once")
+	rediscover := flag.Duration("rediscover", time.Hour, "how often to run discovery again to pick up added or removed tablos")
+	offline := flag.Bool("offline", false, "open the existing caches read-only without contacting any tablo")
+	offlineAfter := flag.Duration("offline-after", 24*time.Hour, "how long a tablo can be missing before it is taken offline")
+	flag.Parse()
 
 	var databaseDir string
-	if len(os.Args) > 1 {
-		databaseDir = os.Args[1]
+	if flag.NArg() > 0 {
+		databaseDir = flag.Arg(0)
 	} else {
 		var err error
 
@@ -58,19 +82,52 @@ func main() {
 
 	mainLog.Println("beginning tablo creation")
 
-	tablos, err := tablo.New(databaseDir)
-	if err != nil {
-		mainLog.Fatal(err)
+	var tablos []*tablo.Tablo
+	if *offline {
+		tablos, err = tablo.OpenOffline(databaseDir)
+		if err != nil {
+			mainLog.Fatal(err)
+		}
+	} else {
+		tablos, err = tablo.New(databaseDir, *discovery, staticTablos)
+		if err != nil && len(tablos) > 0 {
+			// some tablos could not be opened. carry on with the rest
+			mainLog.Println(err)
+			err = nil
+		}
+		if err != nil {
+			mainLog.Println(err)
+			mainLog.Println("no tablos could be reached. opening existing caches read-only")
+			tablos, err = tablo.OpenOffline(databaseDir)
+		}
+		if err != nil {
+			mainLog.Fatal(err)
+		}
 	}
 
-	for _, t := range tablos {
-		defer t.Close()
-	}
+	// tablos changes as tablos are added and removed, so close whatever is in
+	// use at exit
+	defer func() {
+		for _, t := range tablos {
+			t.Close()
+		}
+	}()
 
 	mainLog.Printf("%d tablos found. beginning process loop.\n", len(tablos))
+	lastDiscovery := time.Now()
 
 TabloIteration:
-	for len(tablos) > 0 {
+	for {
+		if !*offline && time.Since(lastDiscovery) >= *rediscover {
+			mainLog.Println("checking for added or removed tablos")
+			tablos, err = tablo.Refresh(tablos, databaseDir, *discovery, staticTablos, *offlineAfter)
+			if err != nil {
+				mainLog.Println(err)
+			}
+			lastDiscovery = time.Now()
+			mainLog.Printf("%d tablos in use\n", len(tablos))
+		}
+
 		for _, tablo := range tablos {
 			exitProgram := processTablo(tablo, mainLog)
 			if exitProgram {
@@ -85,6 +142,20 @@ TabloIteration:
 
 func processTablo(tablo *tablo.Tablo, mainLog *log.Logger) bool {
 	mainLog.Println(tablo.String())
+	if tablo.Offline() {
+		mainLog.Println("tablo is offline. cache is read-only")
+
+		report, err := tablo.Report()
+		if err != nil {
+			mainLog.Println(err)
+
+			return false
+		}
+		mainLog.Println(report)
+
+		return false
+	}
+
 	mainLog.Println("checking whether to update database")
 
 	if tablo.NeedUpdate() {
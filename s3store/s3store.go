@@ -0,0 +1,413 @@
+// Package s3store writes exports to S3-compatible object storage (AWS S3,
+// MinIO, etc.) using path-style requests and signature version 4.
+package s3store
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PartSize is the size of each part of a multipart upload. S3 requires at
+// least 5 MiB for every part but the last.
+const PartSize = 16 * 1024 * 1024
+
+const scheme = "s3://"
+
+// partAttempts is how many times a part is sent before the upload fails
+const partAttempts = 4
+
+// partRetryBackoff is how long to wait before sending a failed part again. It
+// doubles after each attempt.
+var partRetryBackoff = 2 * time.Second
+
+var ErrNotFound = errors.New("object not found")
+
+type Client struct {
+	endpoint        *url.URL
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	http            *http.Client
+}
+
+type Upload struct {
+	client   *Client
+	bucket   string
+	key      string
+	uploadID string
+	parts    []completedPart
+	buffer   bytes.Buffer
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// New creates a client for the S3-compatible service at endpoint
+// (e.g. https://minio.local:9000). An empty endpoint means AWS S3 in region.
+func New(endpoint string, region string, accessKeyID string, secretAccessKey string) (*Client, error) {
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse error in New: %v", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %s", endpoint)
+	}
+
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("s3 access key id and secret access key are required")
+	}
+
+	return &Client{
+		endpoint:        u,
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		http:            &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// NewFromEnv creates a client using the standard AWS environment variables:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_REGION and, for MinIO and other
+// non-AWS services, AWS_ENDPOINT_URL
+func NewFromEnv() (*Client, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	return New(os.Getenv("AWS_ENDPOINT_URL"), region, os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+}
+
+// IsURL reports whether path is an s3://bucket/prefix URL
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, scheme)
+}
+
+// ParseURL splits an s3://bucket/key URL into its bucket and key
+func ParseURL(s3URL string) (string, string, error) {
+	if !IsURL(s3URL) {
+		return "", "", fmt.Errorf("%s is not an s3 url", s3URL)
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(s3URL, scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("no bucket in %s", s3URL)
+	}
+
+	return bucket, key, nil
+}
+
+// List returns the URL of every object under prefix (an s3://bucket/prefix
+// URL)
+func (c *Client) List(prefix string) ([]string, error) {
+	bucket, keyPrefix, err := ParseURL(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []string
+	var continuationToken string
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if keyPrefix != "" {
+			query.Set("prefix", keyPrefix)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, err := c.do(http.MethodGet, bucket, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.Unmarshal(resp, &result)
+		if err != nil {
+			return nil, fmt.Errorf("xml.Unmarshal error in List: %v", err)
+		}
+
+		for _, o := range result.Contents {
+			objects = append(objects, scheme+bucket+"/"+o.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// Size returns the size of an object, or ErrNotFound if it does not exist
+func (c *Client) Size(object string) (int64, error) {
+	bucket, key, err := ParseURL(object)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := c.newRequest(http.MethodHead, bucket, key, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("http.HEAD error in Size: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, object)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return 0, fmt.Errorf("s3 HEAD %s returned %s", object, resp.Status)
+	}
+
+	return resp.ContentLength, nil
+}
+
+// Put writes a small object in a single request
+func (c *Client) Put(object string, data []byte) error {
+	bucket, key, err := ParseURL(object)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(http.MethodPut, bucket, key, nil, data)
+	return err
+}
+
+// Create starts a multipart upload to object. Data written to the upload is
+// sent in PartSize parts. Close completes the upload and Abort discards it.
+func (c *Client) Create(object string) (*Upload, error) {
+	bucket, key, err := ParseURL(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("no key in %s", object)
+	}
+
+	resp, err := c.do(http.MethodPost, bucket, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result initiateMultipartUploadResult
+	err = xml.Unmarshal(resp, &result)
+	if err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal error in Create: %v", err)
+	}
+
+	return &Upload{client: c, bucket: bucket, key: key, uploadID: result.UploadID}, nil
+}
+
+// Write buffers p and uploads each full part. If a part cannot be uploaded it
+// stays in the buffer, and the bytes of p that were buffered are reported.
+func (u *Upload) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), PartSize-u.buffer.Len())
+		u.buffer.Write(p[:n])
+		written += n
+		p = p[n:]
+
+		if u.buffer.Len() < PartSize {
+			break
+		}
+
+		err := u.uploadPart(u.buffer.Bytes())
+		if err != nil {
+			return written, err
+		}
+		u.buffer.Reset()
+	}
+
+	return written, nil
+}
+
+// Close uploads whatever is left in the buffer and completes the upload
+func (u *Upload) Close() error {
+	if u.buffer.Len() > 0 || len(u.parts) == 0 {
+		err := u.uploadPart(u.buffer.Bytes())
+		if err != nil {
+			return err
+		}
+		u.buffer.Reset()
+	}
+
+	body, err := xml.Marshal(completeMultipartUpload{Parts: u.parts})
+	if err != nil {
+		return fmt.Errorf("xml.Marshal error in Close: %v", err)
+	}
+
+	_, err = u.client.do(http.MethodPost, u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, body)
+	return err
+}
+
+// Abort discards the parts uploaded so far
+func (u *Upload) Abort() error {
+	_, err := u.client.do(http.MethodDelete, u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, nil)
+	return err
+}
+
+// uploadPart sends data as the next part, retrying with backoff when the
+// request fails or S3 returns a server error, so one dropped request does not
+// throw away the parts already uploaded
+func (u *Upload) uploadPart(data []byte) error {
+	partNumber := len(u.parts) + 1
+	query := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {u.uploadID},
+	}
+
+	backoff := partRetryBackoff
+	for attempt := 1; ; attempt++ {
+		etag, retry, err := u.sendPart(query, data)
+		if err == nil {
+			u.parts = append(u.parts, completedPart{PartNumber: partNumber, ETag: etag})
+			return nil
+		}
+
+		if !retry || attempt == partAttempts {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// sendPart sends one part once. It returns the part's ETag, or whether the
+// error is worth sending the part again for.
+func (u *Upload) sendPart(query url.Values, data []byte) (string, bool, error) {
+	// the request is signed with the time, so each attempt is signed again
+	req, err := u.client.newRequest(http.MethodPut, u.bucket, u.key, query, data)
+	if err != nil {
+		return "", false, err
+	}
+
+	resp, err := u.client.http.Do(req)
+	if err != nil {
+		return "", true, fmt.Errorf("http.PUT error in uploadPart: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return "", retry, responseError(req, resp, body)
+	}
+
+	return resp.Header.Get("ETag"), false, nil
+}
+
+func (c *Client) newRequest(method string, bucket string, key string, query url.Values, body []byte) (*http.Request, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	// a non-nil empty body would be sent chunked
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest error in newRequest: %v", err)
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	c.sign(req, payloadHash, time.Now())
+
+	return req, nil
+}
+
+// do sends a request and returns the response body. S3 can report errors in
+// the body of a 200 response to a multipart complete, so bodies are checked
+// for an Error element as well as the status code.
+func (c *Client) do(method string, bucket string, key string, query url.Values, body []byte) ([]byte, error) {
+	req, err := c.newRequest(method, bucket, key, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http.%s error in do: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("io.ReadAll error in do: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest || bytes.Contains(respBody, []byte("<Error>")) {
+		return nil, responseError(req, resp, respBody)
+	}
+
+	return respBody, nil
+}
+
+func responseError(req *http.Request, resp *http.Response, body []byte) error {
+	var s3Err s3Error
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("s3 %s %s returned %s: %s", req.Method, req.URL.Path, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("s3 %s %s returned %s", req.Method, req.URL.Path, resp.Status)
+}
@@ -0,0 +1,298 @@
+package s3store
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is just enough of the S3 multipart upload API to test Upload
+// against. Completed objects are kept in objects by bucket/key.
+type fakeS3 struct {
+	mu        sync.Mutex
+	uploads   map[string]map[int][]byte
+	objects   map[string][]byte
+	aborted   []string
+	completed int
+	failWith  string // an S3 error code returned in the body of a 200 complete
+	failParts int    // how many part uploads fail with a 503 before they work
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *Client) {
+	t.Helper()
+
+	fake := &fakeS3{
+		uploads: make(map[string]map[int][]byte),
+		objects: make(map[string][]byte),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := New(server.URL, "us-east-1", "AKID", "SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, client
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hashHex(body) {
+		http.Error(w, "<Error><Code>XAmzContentSHA256Mismatch</Code></Error>", http.StatusBadRequest)
+		return
+	}
+
+	object := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID = fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[uploadID] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>b</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", object, uploadID)
+	case r.Method == http.MethodPut && uploadID != "":
+		parts, ok := f.uploads[uploadID]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+			return
+		}
+		if f.failParts > 0 {
+			f.failParts--
+			http.Error(w, "<Error><Code>SlowDown</Code></Error>", http.StatusServiceUnavailable)
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNumber))
+	case r.Method == http.MethodPost && uploadID != "":
+		parts, ok := f.uploads[uploadID]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+			return
+		}
+		if f.failWith != "" {
+			fmt.Fprintf(w, "<Error><Code>%s</Code><Message>failed</Message></Error>", f.failWith)
+			return
+		}
+
+		var complete completeMultipartUpload
+		err := xml.Unmarshal(body, &complete)
+		if err != nil || len(complete.Parts) != len(parts) {
+			http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+			return
+		}
+
+		var data []byte
+		for i, p := range complete.Parts {
+			if p.PartNumber != i+1 || p.ETag != fmt.Sprintf(`"etag-%d"`, i+1) {
+				http.Error(w, "<Error><Code>InvalidPartOrder</Code></Error>", http.StatusBadRequest)
+				return
+			}
+			data = append(data, parts[p.PartNumber]...)
+		}
+
+		f.objects[object] = data
+		f.completed++
+		delete(f.uploads, uploadID)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(f.uploads, uploadID)
+		f.aborted = append(f.aborted, object)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "<Error><Code>NotImplemented</Code></Error>", http.StatusNotImplemented)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one part", 1024},
+		{"several parts", 2*PartSize + 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client := newFakeS3(t)
+
+			data := bytes.Repeat([]byte("tablo"), tt.size/5+1)[:tt.size]
+			upload, err := client.Create("s3://exports/TV/Show/Season 01/Show - s01e02.mp4")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// write in odd sized pieces so parts are split across writes
+			for rest := data; len(rest) > 0; {
+				n := min(len(rest), 3*1024*1024+7)
+				_, err = upload.Write(rest[:n])
+				if err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+
+			err = upload.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := fake.objects["exports/TV/Show/Season 01/Show - s01e02.mp4"]
+			if !ok {
+				t.Fatalf("object not created. objects: %v", fake.objects)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("object is %d bytes, want %d", len(got), len(data))
+			}
+			if len(fake.uploads) != 0 {
+				t.Errorf("%d uploads left open", len(fake.uploads))
+			}
+		})
+	}
+}
+
+func TestUploadAbort(t *testing.T) {
+	fake, client := newFakeS3(t)
+
+	upload, err := client.Create("s3://exports/Movies/Movie - 2021.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = upload.Write(make([]byte, PartSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = upload.Abort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.uploads) != 0 || fake.completed != 0 || len(fake.objects) != 0 {
+		t.Errorf("aborted upload left %d uploads and %d objects", len(fake.uploads), len(fake.objects))
+	}
+	if len(fake.aborted) != 1 || fake.aborted[0] != "exports/Movies/Movie - 2021.mp4" {
+		t.Errorf("aborted = %v, want [exports/Movies/Movie - 2021.mp4]", fake.aborted)
+	}
+}
+
+func TestUploadCompleteError(t *testing.T) {
+	fake, client := newFakeS3(t)
+	fake.failWith = "InternalError"
+
+	upload, err := client.Create("s3://exports/Movies/Movie - 2021.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = upload.Write([]byte("tablo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// S3 can report a failed complete in the body of a 200 response
+	err = upload.Close()
+	if err == nil || !strings.Contains(err.Error(), "InternalError") {
+		t.Errorf("Close() = %v, want InternalError", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("failed upload created %d objects", len(fake.objects))
+	}
+}
+
+func TestUploadPartRetry(t *testing.T) {
+	backoff := partRetryBackoff
+	partRetryBackoff = time.Millisecond
+	t.Cleanup(func() { partRetryBackoff = backoff })
+
+	fake, client := newFakeS3(t)
+	fake.failParts = partAttempts - 1
+
+	data := bytes.Repeat([]byte("tablo"), (PartSize+1024)/5+1)[:PartSize+1024]
+	upload, err := client.Create("s3://exports/Movies/Movie - 2021.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = upload.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = upload.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(fake.objects["exports/Movies/Movie - 2021.mp4"], data) {
+		t.Errorf("object is %d bytes, want %d", len(fake.objects["exports/Movies/Movie - 2021.mp4"]), len(data))
+	}
+}
+
+func TestUploadPartFailure(t *testing.T) {
+	backoff := partRetryBackoff
+	partRetryBackoff = time.Millisecond
+	t.Cleanup(func() { partRetryBackoff = backoff })
+
+	fake, client := newFakeS3(t)
+	fake.failParts = partAttempts
+
+	upload, err := client.Create("s3://exports/Movies/Movie - 2021.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first part fills up part way through the write, and the rest of
+	// the write is not accepted
+	data := make([]byte, PartSize+1024)
+	n, err := upload.Write(data[:1024])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = upload.Write(data[1024:])
+	if err == nil || !strings.Contains(err.Error(), "SlowDown") {
+		t.Fatalf("Write() error = %v, want SlowDown", err)
+	}
+	if n != PartSize-1024 {
+		t.Errorf("Write() = %d, want %d", n, PartSize-1024)
+	}
+
+	// the failed part was kept, so sending it again finishes the upload
+	n, err = upload.Write(data[1024+n:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1024 {
+		t.Errorf("Write() = %d, want 1024", n)
+	}
+
+	err = upload.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.objects["exports/Movies/Movie - 2021.mp4"]) != len(data) {
+		t.Errorf("object is %d bytes, want %d", len(fake.objects["exports/Movies/Movie - 2021.mp4"]), len(data))
+	}
+}
@@ -23,12 +23,6 @@ func SanitizeFile(s string) string {
 	return out
 }
 
-func SanitizeSql(s string) string {
-	illegalChars := regexp.MustCompile(`'`)
-	out := illegalChars.ReplaceAllString(s, `''`)
-	return out
-}
-
 func minInt(x int, y int) int {
 	switch {
 	case x < y:
@@ -37,4 +31,3 @@ func minInt(x int, y int) int {
 		return y
 	}
 }
-
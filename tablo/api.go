@@ -0,0 +1,41 @@
+package tablo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tabloapi"
+)
+
+// API is the part of the Tablo API a Tablo uses. *tabloapi.Client implements
+// it against a real Tablo; anything else (e.g. a fake in tests) can be used in
+// its place.
+type API interface {
+	Address() string
+	SetAddress(address string)
+	ServerInfo(ctx context.Context) (tabloapi.ServerInfo, error)
+	HardDrives(ctx context.Context) ([]tabloapi.Drive, error)
+	GuideChannels(ctx context.Context) ([]string, error)
+	GuideShows(ctx context.Context) ([]string, error)
+	GuideAirings(ctx context.Context, state string) ([]string, error)
+	RecordingChannels(ctx context.Context) ([]string, error)
+	RecordingShows(ctx context.Context) ([]string, error)
+	RecordingAirings(ctx context.Context) ([]string, error)
+	Batch(ctx context.Context, paths []string, handle func(key string, value json.RawMessage) error) error
+	Unschedule(ctx context.Context, showType string, airingID int) (tabloapi.Airing, error)
+	Watch(ctx context.Context, showType string, recordingID int) (tabloapi.Watch, error)
+	ComSkip(ctx context.Context, showType string, recordingID int) (tabloapi.ComSkipMarkers, error)
+	DeleteRecording(ctx context.Context, showType string, recordingID int) error
+	Fetch(ctx context.Context, uri string, wrap func(io.Reader) io.Reader) ([]byte, error)
+}
+
+// newAPI creates the client for the Tablo at address. A Tablo that stops
+// responding is looked for again with discovery, and requests follow it to its
+// new address.
+func (t *Tablo) newAPI(address string, timeout time.Duration, batchWorkers int) API {
+	client := tabloapi.NewClient(address, timeout, batchWorkers, t.log)
+	client.OnUnreachable(t.rediscover)
+	return client
+}
@@ -0,0 +1,71 @@
+package tablo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// upsertChunkSize is how many objects from a batch are held before they are
+// written to the cache
+const upsertChunkSize = 500
+
+// batchUpsert gets the objects at paths from the Tablo and writes them to the
+// cache with upsert, upsertChunkSize at a time, as they arrive. It returns how
+// many objects were received.
+func batchUpsert[T any](t *Tablo, what string, paths []string, upsert func(map[string]T) error) (int, error) {
+	// mu guards pending and count. writeMu keeps chunks from being written at
+	// the same time, without holding up the batch workers while one is written.
+	var mu sync.Mutex
+	var writeMu sync.Mutex
+	pending := make(map[string]T, upsertChunkSize)
+	count := 0
+
+	write := func(chunk map[string]T) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		t.log.Printf("adding %d %s to database\n", len(chunk), what)
+		err := upsert(chunk)
+		if errors.Is(err, ErrEmptyResult) {
+			// nothing in this chunk could be used, which is no reason to stop
+			t.log.Println(err)
+			return nil
+		}
+		return err
+	}
+
+	err := t.api.Batch(t.ctx, paths, func(key string, value json.RawMessage) error {
+		var object T
+		err := json.Unmarshal(value, &object)
+		if err != nil {
+			return fmt.Errorf("json.Unmarshal error in batchUpsert: %v", err)
+		}
+
+		mu.Lock()
+		pending[key] = object
+		count++
+		if len(pending) < upsertChunkSize {
+			mu.Unlock()
+			return nil
+		}
+		chunk := pending
+		pending = make(map[string]T, upsertChunkSize)
+		mu.Unlock()
+
+		return write(chunk)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	if len(pending) > 0 {
+		err = write(pending)
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
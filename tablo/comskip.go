@@ -0,0 +1,105 @@
+package tablo
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidw1457/tablo-manager/tabloapi"
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+// commercials returns the Tablo's commercial markers for a recording, or none
+// if its commercial detection has not finished. Markers are only extras, so
+// failing to read them does not fail the export.
+func (t *Tablo) commercials(recording tablodb.RecordingRecord) []tabloapi.Commercial {
+	if recording.ComSkipState != "ready" {
+		t.log.Printf("comskip is %s for recording %d. skipping commercial markers\n", recording.ComSkipState, recording.RecordingID)
+		return nil
+	}
+
+	commercials, err := t.getCommercials(recording)
+	if err != nil {
+		t.log.Println(err)
+		return nil
+	}
+
+	if len(commercials) == 0 {
+		t.log.Printf("no commercials marked for recording %d\n", recording.RecordingID)
+	}
+
+	return commercials
+}
+
+// writeEDL saves commercial markers next to an export as a Kodi .edl file
+func (t *Tablo) writeEDL(exportFile string, commercials []tabloapi.Commercial) error {
+	edlFile := strings.TrimSuffix(exportFile, filepath.Ext(exportFile)) + ".edl"
+	t.log.Printf("writing %s\n", edlFile)
+	return t.writeExportFile(edlFile, []byte(edl(commercials)))
+}
+
+// writeChapters saves commercial markers as an ffmpeg metadata file for the
+// remux to add as chapters. The caller removes the file.
+func writeChapters(commercials []tabloapi.Commercial, duration float64) (string, error) {
+	f, err := os.CreateTemp("", "tablo-chapters-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("os.CreateTemp error in writeChapters: %v", err)
+	}
+
+	_, err = f.WriteString(ffmetadata(commercials, duration))
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("os.File.WriteString error in writeChapters: %v", err)
+	}
+
+	return f.Name(), nil
+}
+
+func (t *Tablo) getCommercials(recording tablodb.RecordingRecord) ([]tabloapi.Commercial, error) {
+	markers, err := t.api.ComSkip(t.ctx, recording.ShowType, recording.RecordingID)
+	if err != nil {
+		return nil, err
+	}
+
+	return markers.Commercials, nil
+}
+
+// edl formats commercials as Kodi edit decision list entries. Action 3 marks
+// a commercial break.
+func edl(commercials []tabloapi.Commercial) string {
+	var out strings.Builder
+	for _, c := range commercials {
+		fmt.Fprintf(&out, "%.2f\t%.2f\t3\n", c.Start, c.End)
+	}
+	return out.String()
+}
+
+// ffmetadata builds an ffmpeg metadata file with alternating program and
+// commercial chapters covering the whole recording
+func ffmetadata(commercials []tabloapi.Commercial, duration float64) string {
+	var out strings.Builder
+	out.WriteString(";FFMETADATA1\n")
+
+	chapter := func(start float64, end float64, title string) {
+		if end <= start {
+			return
+		}
+		fmt.Fprintf(&out, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", int64(math.Round(start*1000)), int64(math.Round(end*1000)), title)
+	}
+
+	position := 0.0
+	for _, c := range commercials {
+		chapter(position, c.Start, "Program")
+		chapter(c.Start, c.End, "Commercial")
+		position = c.End
+	}
+	chapter(position, duration, "Program")
+
+	return out.String()
+}
@@ -0,0 +1,168 @@
+package tablo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tabloapi"
+)
+
+// Discovery methods for New. Whichever is chosen is tried first and the other
+// is used as a fallback when it finds nothing.
+const (
+	DiscoverCloud     = "cloud"
+	DiscoverBroadcast = "broadcast"
+)
+
+// legacy Tablos answer a BnGr broadcast on 8881 with a 140 byte packet sent
+// to port 8882
+const discoveryPort = 8881
+const discoveryReplyPort = 8882
+const discoveryTimeout = 3 * time.Second
+
+// discovery requests give up long before the usual request timeout, so Tablos
+// that are not there do not hold up startup and Refresh
+const lookupTimeout = 15 * time.Second
+const serverInfoTimeout = 10 * time.Second
+
+var discoveryBroadcast = &net.UDPAddr{IP: net.IPv4bcast, Port: discoveryPort}
+
+// discover finds Tablos with the chosen method, falling back to the other one
+func discover(method string, discoveryLog *log.Logger) ([]tabloapi.TabloDetails, error) {
+	primary, fallback := discoverCloud, discoverBroadcast
+	primaryName, fallbackName := DiscoverCloud, DiscoverBroadcast
+	switch method {
+	case DiscoverCloud, "":
+	case DiscoverBroadcast:
+		primary, fallback = fallback, primary
+		primaryName, fallbackName = fallbackName, primaryName
+	default:
+		return nil, fmt.Errorf("unknown discovery method %s", method)
+	}
+
+	discoveryLog.Printf("finding tablos with %s discovery\n", primaryName)
+	tablos, err := primary(discoveryLog)
+	if err == nil && len(tablos) > 0 {
+		return tablos, nil
+	}
+
+	if err != nil {
+		discoveryLog.Println(err)
+	}
+	discoveryLog.Printf("no tablos found with %s discovery. trying %s discovery\n", primaryName, fallbackName)
+
+	tablos, fallbackErr := fallback(discoveryLog)
+	if fallbackErr != nil {
+		discoveryLog.Println(fallbackErr)
+		return nil, errors.Join(err, fallbackErr)
+	}
+
+	return tablos, nil
+}
+
+func discoverCloud(cloudLog *log.Logger) ([]tabloapi.TabloDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	return tabloapi.Lookup(ctx, cloudLog)
+}
+
+// discoverBroadcast finds legacy Tablos on the local network by UDP broadcast.
+// The broadcast reply has no name, so each Tablo's server info is read for it.
+func discoverBroadcast(broadcastLog *log.Logger) ([]tabloapi.TabloDetails, error) {
+	replies, err := broadcastDiscovery(discoveryBroadcast, discoveryTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var tablos []tabloapi.TabloDetails
+	for _, r := range replies {
+		info, err := getServerInfo(r.PrivateIP, broadcastLog)
+		if err == nil && info.ServerID == r.ServerID {
+			r.Name = info.Name
+		}
+		if r.Name == "" {
+			r.Name = r.ServerID
+		}
+		tablos = append(tablos, r)
+	}
+
+	return tablos, nil
+}
+
+func broadcastDiscovery(broadcast *net.UDPAddr, timeout time.Duration) ([]tabloapi.TabloDetails, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: discoveryReplyPort})
+	if err != nil {
+		return nil, fmt.Errorf("net.ListenUDP error in broadcastDiscovery: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.WriteToUDP([]byte("BnGr"), broadcast)
+	if err != nil {
+		return nil, fmt.Errorf("net.UDPConn.WriteToUDP error in broadcastDiscovery: %v", err)
+	}
+
+	err = conn.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, fmt.Errorf("net.UDPConn.SetReadDeadline error in broadcastDiscovery: %v", err)
+	}
+
+	var tablos []tabloapi.TabloDetails
+	seen := make(map[string]bool)
+	buffer := make([]byte, 1024)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return tablos, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("net.UDPConn.ReadFromUDP error in broadcastDiscovery: %v", err)
+		}
+
+		tablo, ok := parseDiscoveryReply(buffer[:n])
+		if !ok || seen[tablo.ServerID] {
+			continue
+		}
+
+		if tablo.PrivateIP == "" {
+			tablo.PrivateIP = from.IP.String()
+		}
+
+		seen[tablo.ServerID] = true
+		tablos = append(tablos, tablo)
+	}
+}
+
+// parseDiscoveryReply reads a broadcast reply: the BnGr key followed by
+// null-padded host (64 bytes), private IP (32), server ID (20), device type
+// (10) and board (10)
+func parseDiscoveryReply(reply []byte) (tabloapi.TabloDetails, bool) {
+	if len(reply) < 140 || string(reply[:4]) != "BnGr" {
+		return tabloapi.TabloDetails{}, false
+	}
+
+	field := func(start int, length int) string {
+		return string(bytes.TrimRight(reply[start:start+length], "\x00 "))
+	}
+
+	tablo := tabloapi.TabloDetails{
+		PrivateIP: field(68, 32),
+		ServerID:  field(100, 20),
+	}
+
+	return tablo, tablo.ServerID != ""
+}
+
+// getServerInfo reads the server info of the Tablo at ipAddress, logging any
+// retries to infoLog
+func getServerInfo(ipAddress string, infoLog *log.Logger) (tabloapi.ServerInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverInfoTimeout)
+	defer cancel()
+
+	return tabloapi.NewClient(ipAddress, discoveryTimeout, 0, infoLog).ServerInfo(ctx)
+}
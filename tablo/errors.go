@@ -0,0 +1,13 @@
+package tablo
+
+import "github.com/davidw1457/tablo-manager/tabloapi"
+
+// The errors shared with tabloapi and tablodb, so callers of this package can
+// check for them with errors.Is and errors.As without importing tabloapi
+var (
+	ErrEmptyResult = tabloapi.ErrEmptyResult
+	ErrNotFound    = tabloapi.ErrNotFound
+	ErrUnreachable = tabloapi.ErrUnreachable
+)
+
+type APIError = tabloapi.APIError
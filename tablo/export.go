@@ -0,0 +1,795 @@
+package tablo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/s3store"
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+var errInsufficientSpace = errors.New("not enough free space")
+
+// the ffmpeg muxer for each export file extension. The Tablo sends MPEG-TS,
+// which is remuxed without re-encoding into any other container. .ts exports
+// are saved as sent.
+var exportMuxers = map[string]string{
+	".ts":  "",
+	".mp4": "mp4",
+	".m4v": "mp4",
+	".mov": "mov",
+	".mkv": "matroska",
+}
+
+type hlsSegment struct {
+	uri      string
+	duration float64
+}
+
+// runExport is run by the export workers. Failed exports are left in the queue
+// to be retried the next time it is processed. Exports waiting for free space
+// are only recorded in the queue history the first time they are blocked.
+func (t *Tablo) runExport(queueRecord tablodb.QueueRecord) {
+	t.log.Printf("exporting %s\n", queueRecord.Details)
+	wasBlocked := t.exports.isBlocked(queueRecord.QueueID)
+	err := t.exportRecording(queueRecord)
+	if errors.Is(err, errInsufficientSpace) {
+		if !wasBlocked {
+			t.recordHistory(queueRecord, err)
+		}
+		t.log.Println(err)
+		return
+	}
+
+	t.exports.unblock(queueRecord.QueueID)
+	t.recordHistory(queueRecord, err)
+	if err != nil {
+		t.log.Println(err)
+		return
+	}
+
+	t.log.Printf("deleting queue record %d %s %s\n", queueRecord.QueueID, queueRecord.Action, queueRecord.Details)
+	err = t.database.DeleteQueueRecord(queueRecord.QueueID)
+	if err != nil {
+		t.log.Println(err)
+	}
+}
+
+func (t *Tablo) exportRecording(queueRecord tablodb.QueueRecord) error {
+	toExport := queueRecord.Details
+	exportPath := queueRecord.ExportPath
+	t.log.Printf("exporting recording %s\n", toExport)
+
+	recordingID, err := strconv.Atoi(toExport)
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	if exportPath == "" {
+		exportPath = t.defaultExportPath
+	}
+	if exportPath == "" {
+		err = fmt.Errorf("no export path specified for recording %d", recordingID)
+		t.log.Println(err)
+		return err
+	}
+
+	recording, err := t.database.GetRecording(recordingID)
+	if errors.Is(err, ErrNotFound) {
+		// the recording was deleted from the tablo. nothing left to export
+		t.log.Printf("recording %d no longer exists. skipping export\n", recordingID)
+		return nil
+	} else if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	if recording.RecordingState != "finished" {
+		err = fmt.Errorf("recording %d is %s. only finished recordings can be exported", recordingID, recording.RecordingState)
+		t.log.Println(err)
+		return err
+	}
+
+	exportFile := getExportFilename(recordingToAiring(recording), exportPath, t.exportTemplates)
+	if exportFile == "" {
+		err = fmt.Errorf("unable to build export filename for recording %d", recordingID)
+		t.log.Println(err)
+		return err
+	}
+
+	format, err := exportFormat(exportFile)
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	isS3 := s3store.IsURL(exportPath)
+	if !isS3 {
+		release, err := t.reserveSpace(queueRecord.QueueID, exportPath, exportFile+".part", recording, format != "")
+		if err != nil {
+			t.log.Println(err)
+			return err
+		}
+		defer release()
+
+		err = os.MkdirAll(filepath.Dir(exportFile), userRWX)
+		if err != nil {
+			t.log.Println(err)
+			return err
+		}
+	}
+
+	t.log.Println("getting playlist")
+	playlistURL, err := t.getPlaylistURL(recording)
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	segments, err := t.getSegments(playlistURL)
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	if len(segments) == 0 {
+		err = fmt.Errorf("no segments in playlist for recording %d", recordingID)
+		t.log.Println(err)
+		return err
+	}
+
+	// chapters go in during the remux, so the file that is verified is the
+	// file that is kept
+	commercials := t.commercials(recording)
+	var chapters string
+	if format != "" && len(commercials) > 0 {
+		chapters, err = writeChapters(commercials, playlistDuration(segments))
+		if err != nil {
+			t.log.Println(err)
+			return err
+		}
+		defer os.Remove(chapters)
+	}
+
+	var exported tablodb.ExportedRecord
+	if isS3 {
+		exported, err = t.uploadRecording(recording, exportFile, segments, format, chapters)
+	} else {
+		exported, err = t.downloadRecording(queueRecord.QueueID, recording, exportFile, segments, format, chapters)
+	}
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	err = t.database.UpsertExportedVerification(exported)
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	t.log.Println("writing nfo sidecars")
+	err = t.writeNFO(recording, exportPath, exportFile)
+	if err != nil {
+		// the export itself succeeded. missing metadata is not worth a re-export
+		t.log.Println(err)
+	}
+
+	err = t.database.DeleteExportProgress(queueRecord.QueueID)
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	if len(commercials) > 0 {
+		err = t.writeEDL(exportFile, commercials)
+		if err != nil {
+			t.log.Println(err)
+		}
+	}
+
+	t.runExportHooks(queueRecord, recording, exportFile, exported.Verification)
+
+	if exported.Verification == "verified" {
+		deleteAfterExport, err := t.database.GetDeleteAfterExport()
+		if err != nil {
+			t.log.Println(err)
+			return err
+		}
+
+		if deleteAfterExport {
+			t.deleteRecording(recording, exportFile)
+		}
+	} else {
+		t.log.Printf("%s is %s. keeping recording %d on the tablo\n", exportFile, exported.Verification, recordingID)
+	}
+
+	t.log.Printf("recording %d exported to %s\n", recordingID, exportFile)
+	return nil
+}
+
+// reserveSpace checks that the filesystem holding exportPath has room for the
+// rest of the recording before any of it is downloaded, so exports wait in the
+// queue instead of failing part way through. While exports are blocked on
+// space an alert is kept open for exportPath. The returned func releases the
+// reservation once the download has finished.
+func (t *Tablo) reserveSpace(queueID int, exportPath string, tempFile string, recording tablodb.RecordingRecord, remux bool) (func(), error) {
+	needed := int64(recording.RecordingSize)
+	info, err := os.Stat(tempFile)
+	if err == nil {
+		// a partial export already holds some of the space it needs. with
+		// the TS overhead it can be larger than the recording
+		needed = max(needed-info.Size(), 0)
+	}
+	if remux {
+		// the remuxed copy is written before the download is removed
+		needed += int64(recording.RecordingSize)
+	}
+
+	available, err := freeSpace(existingParent(exportPath))
+	if err != nil {
+		t.log.Println(err)
+		t.log.Printf("unable to check free space in %s. exporting anyway\n", exportPath)
+		return func() {}, nil
+	}
+
+	if !t.exports.reserve(exportPath, needed, available) {
+		err = fmt.Errorf("%w in %s for recording %d. %d bytes needed, %d bytes available", errInsufficientSpace, exportPath, recording.RecordingID, needed, available)
+		if t.exports.block(queueID, exportPath) {
+			alertErr := t.database.RaiseAlert("EXPORTSPACE", exportPath, fmt.Sprintf("exports to %s are waiting for free space. %s needs %d bytes but only %d are available", exportPath, recording.ShowTitle, needed, available))
+			if alertErr != nil {
+				t.log.Println(alertErr)
+			}
+		}
+		return nil, err
+	}
+
+	t.exports.unblock(queueID)
+	if !t.exports.waiting(exportPath) {
+		err = t.database.ClearAlert("EXPORTSPACE", exportPath)
+		if err != nil {
+			t.log.Println(err)
+		}
+	}
+
+	return func() { t.exports.release(exportPath, needed) }, nil
+}
+
+// existingParent returns path or the nearest of its parents that exists
+func existingParent(path string) string {
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// downloadRecording saves the segments of a recording to a local .part file,
+// checkpointing after every segment so an interrupted export can resume. Once
+// complete it is remuxed into format at exportFile, with chapters if there is
+// a chapters file, or moved there for .ts exports.
+func (t *Tablo) downloadRecording(queueID int, recording tablodb.RecordingRecord, exportFile string, segments []hlsSegment, format string, chapters string) (tablodb.ExportedRecord, error) {
+	tempFile := exportFile + ".part"
+	progress := tablodb.ExportProgressRecord{
+		QueueID:     queueID,
+		RecordingID: recording.RecordingID,
+		TempFile:    tempFile,
+	}
+	digest := sha256.New()
+
+	var f *os.File
+	previous, err := t.database.GetExportProgress(queueID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return tablodb.ExportedRecord{}, err
+	} else if err == nil && previous.TempFile == tempFile && previous.SegmentsCompleted <= len(segments) {
+		t.log.Printf("verifying %d bytes already written to %s\n", previous.BytesWritten, tempFile)
+		f, err = resumePartial(tempFile, previous, digest)
+		if err != nil {
+			t.log.Println(err)
+			t.log.Println("restarting export from the first segment")
+			digest.Reset()
+		} else {
+			progress = previous
+		}
+	}
+
+	if f == nil {
+		f, err = os.Create(tempFile)
+		if err != nil {
+			return tablodb.ExportedRecord{}, fmt.Errorf("os.Create error in downloadRecording: %v", err)
+		}
+	}
+
+	t.log.Printf("downloading segments %d to %d to %s\n", progress.SegmentsCompleted+1, len(segments), tempFile)
+	for _, s := range segments[progress.SegmentsCompleted:] {
+		data, err := t.api.Fetch(t.ctx, s.uri, t.exports.limiter.reader)
+		if err != nil {
+			f.Close()
+			return tablodb.ExportedRecord{}, err
+		}
+
+		_, err = f.Write(data)
+		if err != nil {
+			f.Close()
+			return tablodb.ExportedRecord{}, fmt.Errorf("os.File.Write error in downloadRecording: %v", err)
+		}
+		digest.Write(data)
+
+		progress.SegmentsCompleted++
+		progress.BytesWritten += int64(len(data))
+		progress.Checksum = hex.EncodeToString(digest.Sum(nil))
+		err = t.database.UpsertExportProgress(progress)
+		if err != nil {
+			f.Close()
+			return tablodb.ExportedRecord{}, err
+		}
+	}
+
+	err = f.Close()
+	if err != nil {
+		return tablodb.ExportedRecord{}, fmt.Errorf("os.File.Close error in downloadRecording: %v", err)
+	}
+
+	if format == "" {
+		t.log.Printf("moving %s to %s\n", tempFile, exportFile)
+		err = os.Rename(tempFile, exportFile)
+		if err != nil {
+			return tablodb.ExportedRecord{}, fmt.Errorf("os.Rename error in downloadRecording: %v", err)
+		}
+	} else {
+		// the .part file is kept until the remux succeeds, so a failed remux
+		// is retried without downloading the recording again
+		t.log.Printf("remuxing %s to %s\n", tempFile, exportFile)
+		err = remux(tempFile, exportFile, format, chapters)
+		if err != nil {
+			return tablodb.ExportedRecord{}, err
+		}
+
+		err = os.Remove(tempFile)
+		if err != nil {
+			t.log.Println(err)
+		}
+	}
+
+	t.log.Printf("verifying %s\n", exportFile)
+	info, err := os.Stat(exportFile)
+	if err != nil {
+		return tablodb.ExportedRecord{}, fmt.Errorf("os.Stat error in downloadRecording: %v", err)
+	}
+
+	duration, err := probeDuration(exportFile)
+	if err != nil {
+		t.log.Printf("unable to probe %s (%v). using playlist duration\n", exportFile, err)
+		duration = playlistDuration(segments)
+	}
+
+	return t.verifyExport(exportFile, recording, progress.BytesWritten, info.Size(), duration)
+}
+
+// deleteRecording removes an exported recording from the Tablo and the cache.
+// The export has already succeeded at this point, so failures are recorded in
+// the audit trail rather than returned.
+func (t *Tablo) deleteRecording(recording tablodb.RecordingRecord, exportFile string) {
+	t.log.Printf("deleting recording %d from tablo\n", recording.RecordingID)
+
+	audit := tablodb.DeleteAuditRecord{
+		RecordingID: recording.RecordingID,
+		ShowID:      recording.ShowID,
+		EpisodeID:   recording.EpisodeID,
+		ShowTitle:   recording.ShowTitle,
+		FullPath:    exportFile,
+		DeletedAt:   time.Now(),
+		Result:      "deleted",
+	}
+
+	err := t.api.DeleteRecording(t.ctx, recording.ShowType, recording.RecordingID)
+	if err != nil {
+		t.log.Println(err)
+		audit.Result = "failed: " + err.Error()
+	} else {
+		err = t.database.DeleteRecording(recording.RecordingID)
+		if err != nil {
+			t.log.Println(err)
+			audit.Result = "deleted from tablo. cache not updated: " + err.Error()
+		}
+	}
+
+	err = t.database.InsertDeleteAudit(audit)
+	if err != nil {
+		t.log.Println(err)
+	}
+}
+
+// verifyExport compares the bytes downloaded and the duration of an exported
+// file with the recording metadata reported by the Tablo. Exports outside the
+// configured tolerance are marked suspect. The recording size is that of the
+// MPEG-TS the Tablo sends, so it is checked against the download rather than
+// the size of a remuxed file.
+func (t *Tablo) verifyExport(exportFile string, recording tablodb.RecordingRecord, downloaded int64, size int64, duration float64) (tablodb.ExportedRecord, error) {
+	exported := tablodb.ExportedRecord{
+		FullPath:     exportFile,
+		RecordingID:  recording.RecordingID,
+		Verification: "suspect",
+		FileSize:     size,
+		FileDuration: int(math.Round(duration)),
+	}
+
+	tolerance, err := t.database.GetVerifyTolerance()
+	if err != nil {
+		return exported, err
+	}
+
+	sizeOK := withinTolerance(float64(downloaded), float64(recording.RecordingSize), tolerance)
+	durationOK := withinTolerance(duration, float64(recording.RecordingDuration), tolerance)
+
+	if sizeOK && durationOK {
+		exported.Verification = "verified"
+	} else {
+		t.log.Printf("%s is suspect. downloaded %d bytes (expected %d), duration %d (expected %d)\n", exportFile, downloaded, recording.RecordingSize, exported.FileDuration, recording.RecordingDuration)
+	}
+
+	return exported, nil
+}
+
+// exportFormat returns the ffmpeg muxer for the extension of exportFile, or ""
+// for .ts exports
+func exportFormat(exportFile string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(exportFile))
+	format, ok := exportMuxers[ext]
+	if !ok {
+		return "", fmt.Errorf("unable to export %s. only .ts, .mp4, .m4v, .mov and .mkv exports are supported", exportFile)
+	}
+
+	if format != "" {
+		_, err := exec.LookPath("ffmpeg")
+		if err != nil {
+			return "", fmt.Errorf("ffmpeg is needed to export %s files: %v", ext, err)
+		}
+	}
+
+	return format, nil
+}
+
+// remuxArgs builds the ffmpeg arguments that copy the MPEG-TS streams in input
+// into a format container at output, adding the chapters in the ffmpeg
+// metadata file chapters if it is not ""
+func remuxArgs(input string, output string, format string, chapters string) []string {
+	args := []string{"-y", "-v", "error", "-i", input}
+	if chapters != "" {
+		args = append(args, "-i", chapters, "-map_metadata", "1", "-map_chapters", "1")
+	}
+	args = append(args, "-map", "0:v", "-map", "0:a?", "-c", "copy", "-f", format)
+	if output == "pipe:1" && (format == "mp4" || format == "mov") {
+		// a pipe cannot be seeked back to write the index at the start
+		args = append(args, "-movflags", "frag_keyframe+empty_moov")
+	}
+	return append(args, output)
+}
+
+// remux copies the streams of tsFile into a format container at exportFile
+// without re-encoding them
+func remux(tsFile string, exportFile string, format string, chapters string) error {
+	tempFile := exportFile + ".remux"
+	out, err := exec.Command("ffmpeg", remuxArgs(tsFile, tempFile, format, chapters)...).CombinedOutput()
+	if err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("ffmpeg error in remux: %v: %s", err, out)
+	}
+
+	err = os.Rename(tempFile, exportFile)
+	if err != nil {
+		return fmt.Errorf("os.Rename error in remux: %v", err)
+	}
+
+	return nil
+}
+
+// remuxWriter remuxes the MPEG-TS written to it with ffmpeg, for exports that
+// are streamed rather than saved to a file first
+type remuxWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+// startRemux starts ffmpeg writing a format container to w
+func startRemux(w io.Writer, format string, chapters string) (*remuxWriter, error) {
+	r := &remuxWriter{cmd: exec.Command("ffmpeg", remuxArgs("pipe:0", "pipe:1", format, chapters)...)}
+	r.cmd.Stdout = w
+	r.cmd.Stderr = &r.stderr
+
+	stdin, err := r.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("exec.Cmd.StdinPipe error in startRemux: %v", err)
+	}
+	r.stdin = stdin
+
+	err = r.cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("exec.Cmd.Start error in startRemux: %v", err)
+	}
+
+	return r, nil
+}
+
+func (r *remuxWriter) Write(p []byte) (int, error) {
+	return r.stdin.Write(p)
+}
+
+// Close ends the input and waits for ffmpeg to write the rest of the output
+func (r *remuxWriter) Close() error {
+	r.stdin.Close()
+	err := r.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("ffmpeg error in remuxWriter: %v: %s", err, r.stderr.Bytes())
+	}
+	return nil
+}
+
+// probeDuration returns the duration of a media file in seconds using ffprobe
+func probeDuration(file string) (float64, error) {
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := exec.Command(ffprobe, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", file).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe error in probeDuration: %v", err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("strconv.ParseFloat error in probeDuration: %v", err)
+	}
+
+	return duration, nil
+}
+
+func playlistDuration(segments []hlsSegment) float64 {
+	var duration float64
+	for _, s := range segments {
+		duration += s.duration
+	}
+	return duration
+}
+
+func withinTolerance(actual float64, expected float64, tolerance float64) bool {
+	if expected <= 0 {
+		return false
+	}
+	return math.Abs(actual-expected) <= expected*tolerance
+}
+
+// resumePartial checks that the first BytesWritten bytes of a partial export
+// still match the checkpointed checksum and, if so, returns the file opened
+// for appending with h holding the running checksum.
+func resumePartial(tempFile string, progress tablodb.ExportProgressRecord, h hash.Hash) (*os.File, error) {
+	f, err := os.OpenFile(tempFile, os.O_RDWR, userRWX)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile error in resumePartial: %v", err)
+	}
+
+	written, err := io.CopyN(h, f, progress.BytesWritten)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("partial file has %d of %d checkpointed bytes: %v", written, progress.BytesWritten, err)
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != progress.Checksum {
+		f.Close()
+		return nil, fmt.Errorf("checksum mismatch for %s", tempFile)
+	}
+
+	// discard anything written after the last checkpoint
+	err = f.Truncate(progress.BytesWritten)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("os.File.Truncate error in resumePartial: %v", err)
+	}
+
+	_, err = f.Seek(progress.BytesWritten, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("os.File.Seek error in resumePartial: %v", err)
+	}
+
+	return f, nil
+}
+
+// enqueueExports queues an export for each finished recording that has not
+// been exported. A recording counts as exported if the exported table has it,
+// wherever it went, or if a file in the exported table matches it by identity.
+func (t *Tablo) enqueueExports() error {
+	if t.defaultExportPath == "" {
+		t.log.Println("no default export path. skipping automatic exports")
+		return nil
+	}
+
+	recordings, err := t.database.GetAutoExportRecordings()
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	exportedIDs, err := t.database.GetExportedRecordingIDs()
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	exportedMap := make(map[int]bool)
+	for _, id := range exportedIDs {
+		exportedMap[id] = true
+	}
+
+	currentExported, err := t.database.GetExported()
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	// library files found by the export path scan have no recordingID
+	var airings []tablodb.ScheduledAiringRecord
+	for _, r := range recordings {
+		airings = append(airings, recordingToAiring(r))
+	}
+	matched, _ := matchLibrary(currentExported, airings)
+	for recordingID := range matched {
+		exportedMap[recordingID] = true
+	}
+
+	queue, err := t.database.GetQueue()
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
+	queuedMap := make(map[string]bool)
+	for _, q := range queue {
+		if q.Action == "EXPORT" {
+			queuedMap[q.Details] = true
+		}
+	}
+
+	enqueued := 0
+	for _, r := range recordings {
+		recordingID := strconv.Itoa(r.RecordingID)
+		if queuedMap[recordingID] || exportedMap[r.RecordingID] {
+			continue
+		}
+
+		err = t.database.Enqueue("EXPORT", recordingID, "")
+		if err != nil {
+			t.log.Println(err)
+			return err
+		}
+		enqueued++
+	}
+
+	t.log.Printf("%d exports enqueued\n", enqueued)
+	return nil
+}
+
+func (t *Tablo) getPlaylistURL(recording tablodb.RecordingRecord) (string, error) {
+	watch, err := t.api.Watch(t.ctx, recording.ShowType, recording.RecordingID)
+	if err != nil {
+		return "", err
+	}
+
+	if watch.PlaylistURL == "" {
+		return "", fmt.Errorf("no playlist returned for recording %d", recording.RecordingID)
+	}
+
+	return watch.PlaylistURL, nil
+}
+
+// getSegments returns the media segments of an HLS playlist. When given a
+// master playlist, the highest bandwidth variant is used.
+func (t *Tablo) getSegments(playlistURL string) ([]hlsSegment, error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse error in getSegments: %v", err)
+	}
+
+	playlist, err := t.api.Fetch(t.ctx, playlistURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []hlsSegment
+	var variant string
+	var variantBandwidth int
+	var streamBandwidth int
+	var isStream bool
+	var duration float64
+
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			isStream = true
+			streamBandwidth = 0
+			for _, attr := range strings.Split(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"), ",") {
+				if v, ok := strings.CutPrefix(attr, "BANDWIDTH="); ok {
+					streamBandwidth, _ = strconv.Atoi(v)
+				}
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, _ = strconv.ParseFloat(v, 64)
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			ref, err := url.Parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("url.Parse error in getSegments: %v", err)
+			}
+			resolved := base.ResolveReference(ref).String()
+
+			if isStream {
+				if variant == "" || streamBandwidth > variantBandwidth {
+					variant = resolved
+					variantBandwidth = streamBandwidth
+				}
+				isStream = false
+				continue
+			}
+
+			segments = append(segments, hlsSegment{uri: resolved, duration: duration})
+			duration = 0
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("bufio.Scanner error in getSegments: %v", err)
+	}
+
+	if len(segments) == 0 && variant != "" {
+		return t.getSegments(variant)
+	}
+
+	return segments, nil
+}
+
+func recordingToAiring(recording tablodb.RecordingRecord) tablodb.ScheduledAiringRecord {
+	return tablodb.ScheduledAiringRecord{
+		AiringID:     recording.RecordingID,
+		AirDate:      recording.AirDate,
+		ShowType:     recording.ShowType,
+		ShowTitle:    recording.ShowTitle,
+		Season:       recording.Season,
+		Episode:      recording.Episode,
+		EpisodeTitle: recording.EpisodeTitle,
+		ReleaseYear:  recording.ReleaseYear,
+		CallSign:     recording.CallSign,
+		Teams:        recording.Teams,
+	}
+}
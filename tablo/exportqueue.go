@@ -0,0 +1,227 @@
+package tablo
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+// exporter runs EXPORT queue items in the background, in queue order, with at
+// most workers downloads at a time so that long exports do not hold up guide
+// and recording updates
+type exporter struct {
+	mu       sync.Mutex
+	workers  int
+	active   int
+	pending  []tablodb.QueueRecord
+	known    map[int]bool
+	reserved map[string]int64
+	blocked  map[int]string // export path of each export waiting for space
+	limiter  *throttle
+	run      func(tablodb.QueueRecord)
+	done     sync.WaitGroup
+}
+
+func newExporter(workers int, bytesPerSecond int64, run func(tablodb.QueueRecord)) *exporter {
+	return &exporter{
+		workers:  workers,
+		known:    make(map[int]bool),
+		reserved: make(map[string]int64),
+		blocked:  make(map[int]string),
+		limiter:  newThrottle(bytesPerSecond),
+		run:      run,
+	}
+}
+
+// add queues an export unless it is already pending or running. It returns
+// false for exports that were already known.
+func (e *exporter) add(queueRecord tablodb.QueueRecord) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.known[queueRecord.QueueID] {
+		return false
+	}
+
+	e.known[queueRecord.QueueID] = true
+	e.pending = append(e.pending, queueRecord)
+
+	if e.active < e.workers {
+		e.active++
+		e.done.Add(1)
+		go e.work()
+	}
+
+	return true
+}
+
+func (e *exporter) work() {
+	defer e.done.Done()
+
+	for {
+		e.mu.Lock()
+		if len(e.pending) == 0 {
+			e.active--
+			e.mu.Unlock()
+			return
+		}
+		queueRecord := e.pending[0]
+		e.pending = e.pending[1:]
+		e.mu.Unlock()
+
+		e.run(queueRecord)
+
+		// forget the item so a failed export is retried when the queue is
+		// next loaded
+		e.mu.Lock()
+		delete(e.known, queueRecord.QueueID)
+		e.mu.Unlock()
+	}
+}
+
+func (e *exporter) running() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.known)
+}
+
+// reserve sets aside needed bytes of the available space in exportPath for a
+// running export. It returns false when the exports already running to the
+// same path leave too little room.
+func (e *exporter) reserve(exportPath string, needed int64, available uint64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if int64(available)-e.reserved[exportPath] < needed {
+		return false
+	}
+
+	e.reserved[exportPath] += needed
+	return true
+}
+
+func (e *exporter) release(exportPath string, needed int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.reserved[exportPath] -= needed
+	if e.reserved[exportPath] <= 0 {
+		delete(e.reserved, exportPath)
+	}
+}
+
+// block marks an export as waiting for space in exportPath. It returns false
+// if it was already waiting.
+func (e *exporter) block(queueID int, exportPath string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, ok := e.blocked[queueID]
+	e.blocked[queueID] = exportPath
+	return !ok
+}
+
+func (e *exporter) unblock(queueID int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.blocked, queueID)
+}
+
+func (e *exporter) isBlocked(queueID int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, ok := e.blocked[queueID]
+	return ok
+}
+
+// waiting reports whether any export is waiting for space in exportPath
+func (e *exporter) waiting(exportPath string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, p := range e.blocked {
+		if p == exportPath {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until all pending and running exports have finished
+func (e *exporter) wait() {
+	e.done.Wait()
+}
+
+// throttle is a token bucket shared by all running exports that caps the
+// total download rate. A nil throttle does not limit anything.
+type throttle struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+func newThrottle(bytesPerSecond int64) *throttle {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &throttle{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// take removes n bytes from the bucket, sleeping until the bucket is no longer
+// overdrawn. The bucket holds at most one second of data.
+func (t *throttle) take(n int) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+	t.last = now
+	t.tokens -= float64(n)
+
+	var delay time.Duration
+	if t.tokens < 0 {
+		delay = time.Duration(-t.tokens / t.rate * float64(time.Second))
+	}
+	t.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// reader wraps r so that reads from it are throttled
+func (t *throttle) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: t}
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	// keep reads small so concurrent downloads share the bandwidth evenly
+	if len(p) > 32*1024 {
+		p = p[:32*1024]
+	}
+
+	n, err := tr.r.Read(p)
+	tr.limiter.take(n)
+	return n, err
+}
@@ -0,0 +1,285 @@
+package tablo
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tabloapi"
+)
+
+// fakeTablo is an in-process legacy Tablo. Tests fill it with channels, shows,
+// airings, recordings and drives, keyed by the path the real API uses for
+// them, and can check which PATCH requests it received.
+type fakeTablo struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	info    tabloapi.ServerInfo
+	drives  []tabloapi.Drive
+	lists   map[string][]string // paths returned by each list endpoint
+	objects map[string]any      // objects returned by /batch and PATCH
+	patches []fakeRequest
+}
+
+type fakeRequest struct {
+	path string
+	body string
+}
+
+// the list endpoints of a legacy Tablo
+const (
+	guideChannels     = "/guide/channels"
+	guideShows        = "/guide/shows"
+	guideAirings      = "/guide/airings"
+	recordingChannels = "/recordings/channels"
+	recordingShows    = "/recordings/shows"
+	recordingAirings  = "/recordings/airings"
+)
+
+func newFakeTablo(t *testing.T) *fakeTablo {
+	f := &fakeTablo{
+		info:    tabloapi.ServerInfo{ServerID: "SID_TEST", Name: "Test Tablo"},
+		lists:   make(map[string][]string),
+		objects: make(map[string]any),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// address is where the fake is listening, as host:port
+func (f *fakeTablo) address() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+// add serves object at path and lists path in list
+func (f *fakeTablo) add(list string, path string, object any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.objects[path]; !ok {
+		f.lists[list] = append(f.lists[list], path)
+	}
+	f.objects[path] = object
+}
+
+// remove stops serving the object at path, as if it was deleted on the Tablo
+func (f *fakeTablo) remove(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.objects, path)
+	for list, paths := range f.lists {
+		for i, p := range paths {
+			if p == path {
+				f.lists[list] = append(paths[:i:i], paths[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// addChannel adds a channel to section, guide or recordings
+func (f *fakeTablo) addChannel(section string, channelID int, callSign string) {
+	f.add("/"+section+"/channels", "/"+section+"/channels/"+strconv.Itoa(channelID), tabloapi.Channel{
+		ObjectID: channelID,
+		Channel:  tabloapi.ChannelDetails{CallSign: callSign, Major: channelID, Minor: 1},
+	})
+}
+
+// addSeries adds a series to section, guide or recordings. A recorded series
+// points at guideID, its series in the guide.
+func (f *fakeTablo) addSeries(section string, showID int, title string, guideID int) {
+	path := "/" + section + "/series/" + strconv.Itoa(showID)
+	show := tabloapi.Show{
+		ObjectID: showID,
+		Path:     path,
+		Series:   tabloapi.SeriesDetails{Title: title, EpisodeRuntime: 1800},
+		Keep:     tabloapi.KeepDetails{Rule: "none"},
+	}
+	if guideID != 0 {
+		show.GuidePath = "/guide/series/" + strconv.Itoa(guideID)
+	}
+	f.add("/"+section+"/shows", path, show)
+}
+
+// addEpisode adds a half hour guide airing of a series on channelID
+func (f *fakeTablo) addEpisode(airingID int, showID int, channelID int, airDate time.Time, state string) {
+	f.add(guideAirings, episodePath("guide", airingID), tabloapi.Airing{
+		ObjectID:   airingID,
+		SeriesPath: "/guide/series/" + strconv.Itoa(showID),
+		Episode:    tabloapi.EpisodeDetails{Title: "Episode " + strconv.Itoa(airingID), Number: airingID, SeasonNumber: 1},
+		AiringDetails: tabloapi.AiringDetails{
+			Datetime: airDate.UTC().Format("2006-01-02T15:04Z"),
+			Duration: 1800,
+			Channel:  tabloapi.Channel{ObjectID: channelID},
+		},
+		Schedule: tabloapi.AiringScheduleDetails{State: state},
+	})
+}
+
+// addRecording adds a finished half hour recording of a recorded series
+func (f *fakeTablo) addRecording(recordingID int, showID int, channelID int, airDate time.Time) {
+	f.add(recordingAirings, episodePath("recordings", recordingID), tabloapi.Recording{
+		ObjectID:   recordingID,
+		SeriesPath: "/recordings/series/" + strconv.Itoa(showID),
+		Episode:    tabloapi.EpisodeDetails{Title: "Episode " + strconv.Itoa(recordingID), Number: recordingID, SeasonNumber: 1},
+		AiringDetails: tabloapi.AiringDetails{
+			Datetime: airDate.UTC().Format("2006-01-02T15:04Z"),
+			Duration: 1800,
+			Channel:  tabloapi.Channel{ObjectID: channelID},
+		},
+		Schedule: tabloapi.AiringScheduleDetails{State: "none"},
+		VideoDetails: tabloapi.VideoDetails{
+			State:    "finished",
+			Clean:    true,
+			Size:     1 << 20,
+			Duration: 1800,
+			ComSkip:  tabloapi.ComSkipDetails{State: "none"},
+		},
+	})
+}
+
+func episodePath(section string, objectID int) string {
+	return "/" + section + "/series/episodes/" + strconv.Itoa(objectID)
+}
+
+func (f *fakeTablo) setDrives(drives ...tabloapi.Drive) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.drives = drives
+}
+
+// setState changes the schedule state of the airing at path
+func (f *fakeTablo) setState(path string, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	airing := f.objects[path].(tabloapi.Airing)
+	airing.Schedule.State = state
+	f.objects[path] = airing
+}
+
+// patched returns the PATCH requests received so far
+func (f *fakeTablo) patched() []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]fakeRequest(nil), f.patches...)
+}
+
+func (f *fakeTablo) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/server/info":
+		writeJSON(w, http.StatusOK, f.info)
+	case r.Method == http.MethodGet && r.URL.Path == "/server/harddrives":
+		writeJSON(w, http.StatusOK, f.drives)
+	case r.Method == http.MethodGet && r.URL.Path == guideAirings && r.URL.Query().Get("state") != "":
+		writeJSON(w, http.StatusOK, f.airingsInState(r.URL.Query().Get("state")))
+	case r.Method == http.MethodGet && isList(r.URL.Path):
+		paths := f.lists[r.URL.Path]
+		if paths == nil {
+			paths = []string{}
+		}
+		writeJSON(w, http.StatusOK, paths)
+	case r.Method == http.MethodPost && r.URL.Path == "/batch":
+		f.batch(w, r)
+	case r.Method == http.MethodPatch:
+		f.patch(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "object_not_found")
+	}
+}
+
+func isList(path string) bool {
+	switch path {
+	case guideChannels, guideShows, guideAirings, recordingChannels, recordingShows, recordingAirings:
+		return true
+	}
+	return false
+}
+
+// airingsInState lists the guide airings in state. The API is asked for
+// conflicted airings, but marks them as conflict.
+func (f *fakeTablo) airingsInState(state string) []string {
+	if state == "conflicted" {
+		state = "conflict"
+	}
+
+	paths := []string{}
+	for _, path := range f.lists[guideAirings] {
+		if f.objects[path].(tabloapi.Airing).Schedule.State == state {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (f *fakeTablo) batch(w http.ResponseWriter, r *http.Request) {
+	var paths []string
+	err := json.NewDecoder(r.Body).Decode(&paths)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	response := make(map[string]any)
+	for _, path := range paths {
+		if object, ok := f.objects[path]; ok {
+			response[path] = object
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (f *fakeTablo) patch(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.patches = append(f.patches, fakeRequest{path: r.URL.Path, body: string(body)})
+
+	airing, ok := f.objects[r.URL.Path].(tabloapi.Airing)
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found")
+		return
+	}
+
+	var change struct {
+		Scheduled *bool `json:"scheduled"`
+	}
+	err := json.Unmarshal(body, &change)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	if change.Scheduled != nil && !*change.Scheduled {
+		airing.Schedule.State = "none"
+	} else if change.Scheduled != nil {
+		airing.Schedule.State = "scheduled"
+	}
+	f.objects[r.URL.Path] = airing
+
+	writeJSON(w, http.StatusOK, airing)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with an error object like the one the Tablo sends
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]tabloapi.RequestError{"error": {Code: code, Description: http.StatusText(status)}})
+}
@@ -0,0 +1,161 @@
+package tablo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/s3store"
+	"github.com/davidw1457/tablo-manager/stringmanip"
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+// defaultExportTemplates are used for any show type without a template in
+// systemInfo. Placeholders are wrapped in braces. A section wrapped in square
+// brackets is dropped when any placeholder inside it is empty. Templates always
+// use / between folders.
+var defaultExportTemplates = map[string]string{
+	"series": "TV/{show}/Season {season}/{show} - s{season}e{episode}[ - {title}].mp4",
+	"movies": "Movies/{show} - {year}.mp4",
+	"sports": "Sports/{show}/{show} - {season} - {title}.mp4",
+}
+
+var templatePlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+var templateOptional = regexp.MustCompile(`\[([^\[\]]*)\]`)
+
+func getExportFilename(airing tablodb.ScheduledAiringRecord, path string, exportTemplates map[string]string) string {
+	exportTemplate := getExportTemplate(airing.ShowType, exportTemplates)
+	if exportTemplate == "" {
+		return ""
+	}
+
+	return joinExportPath(path, expandTemplate(exportTemplate, templateValues(airing)))
+}
+
+// getShowFolder returns the folder that holds every export of a show: the
+// template up to the first folder named after the show, or the export's own
+// folder if the template has none
+func getShowFolder(airing tablodb.ScheduledAiringRecord, path string, exportTemplates map[string]string) string {
+	exportTemplate := getExportTemplate(airing.ShowType, exportTemplates)
+	folders := strings.Split(exportTemplate, "/")
+
+	for i, f := range folders[:len(folders)-1] {
+		if strings.Contains(f, "{show}") {
+			showFolder := expandTemplate(strings.Join(folders[:i+1], "/"), templateValues(airing))
+			return joinExportPath(path, showFolder)
+		}
+	}
+
+	exportFile := getExportFilename(airing, path, exportTemplates)
+	if s3store.IsURL(path) {
+		return exportFile[:strings.LastIndex(exportFile, "/")]
+	}
+	return filepath.Dir(exportFile)
+}
+
+// getExportRoots returns the folders under path that the export templates
+// write to, so the exported scan only walks folders this app manages
+func getExportRoots(path string, exportTemplates map[string]string) []string {
+	var roots []string
+	seen := make(map[string]bool)
+
+	for _, showType := range []string{"movies", "sports", "series"} {
+		folders := strings.Split(getExportTemplate(showType, exportTemplates), "/")
+		root := path
+		if len(folders) > 1 && !strings.ContainsAny(folders[0], "{[") {
+			root = joinExportPath(path, folders[0])
+		}
+
+		if root == path {
+			// the whole export path is in use. no need to walk anything else
+			return []string{path}
+		}
+
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+
+	return roots
+}
+
+// joinExportPath adds a template-relative path to an export path. s3:// export
+// paths always use / between folders.
+func joinExportPath(path string, relative string) string {
+	if s3store.IsURL(path) {
+		return strings.TrimSuffix(path, "/") + "/" + relative
+	}
+	return path + string(os.PathSeparator) + filepath.FromSlash(relative)
+}
+
+func getExportTemplate(showType string, exportTemplates map[string]string) string {
+	if exportTemplates[showType] != "" {
+		return exportTemplates[showType]
+	}
+	return defaultExportTemplates[showType]
+}
+
+func expandTemplate(exportTemplate string, values map[string]string) string {
+	replace := func(s string) string {
+		return templatePlaceholder.ReplaceAllStringFunc(s, func(p string) string {
+			value, ok := values[p[1:len(p)-1]]
+			if !ok {
+				return p
+			}
+			return value
+		})
+	}
+
+	expanded := templateOptional.ReplaceAllStringFunc(exportTemplate, func(section string) string {
+		section = section[1 : len(section)-1]
+		for _, p := range templatePlaceholder.FindAllStringSubmatch(section, -1) {
+			if values[p[1]] == "" {
+				return ""
+			}
+		}
+		return replace(section)
+	})
+
+	return replace(expanded)
+}
+
+func templateValues(airing tablodb.ScheduledAiringRecord) map[string]string {
+	airDate := time.Unix(int64(airing.AirDate), 0)
+	episodeTitle := stringmanip.SanitizeFile(airing.EpisodeTitle)
+
+	var season string
+	switch {
+	case airing.Season == "":
+		season = "00"
+	case len(airing.Season) == 1 && airing.ShowType == "series":
+		season = "0" + stringmanip.SanitizeFile(airing.Season)
+	default:
+		season = stringmanip.SanitizeFile(airing.Season)
+	}
+
+	episode := fmt.Sprintf("%02d", airing.Episode)
+	if episode == "00" && episodeTitle == "" {
+		episode = airDate.Format("200601021504")
+	}
+
+	year := strconv.Itoa(airDate.Year())
+	if airing.ShowType == "movies" {
+		year = strconv.Itoa(airing.ReleaseYear)
+	}
+
+	return map[string]string{
+		"show":     stringmanip.SanitizeFile(airing.ShowTitle),
+		"season":   season,
+		"episode":  episode,
+		"title":    episodeTitle,
+		"airdate":  airDate.Format("2006-01-02"),
+		"year":     year,
+		"callsign": stringmanip.SanitizeFile(airing.CallSign),
+		"teams":    stringmanip.SanitizeFile(airing.Teams),
+	}
+}
@@ -0,0 +1,132 @@
+package tablo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tabloapi"
+)
+
+// main.log is opened once per database directory and shared by every Tablo's
+// log, including Tablos added by Refresh
+var mainLogFiles = make(map[string]*os.File)
+var mainLogLock sync.Mutex
+
+func openMainLog(databaseDir string) (*os.File, error) {
+	mainLogLock.Lock()
+	defer mainLogLock.Unlock()
+
+	if mainLogFiles[databaseDir] == nil {
+		logFile, err := os.OpenFile(databaseDir+string(os.PathSeparator)+"main.log", os.O_WRONLY|os.O_APPEND|os.O_CREATE, userRWX)
+		if err != nil {
+			return nil, fmt.Errorf("os.OpenFile error in openMainLog: %v", err)
+		}
+		mainLogFiles[databaseDir] = logFile
+	}
+
+	return mainLogFiles[databaseDir], nil
+}
+
+// Refresh runs discovery again (or rereads the configured Tablos) and returns
+// the Tablos to use from now on. Tablos found for the first time get a cache
+// and are added. A Tablo that has not been found for offlineAfter, and no
+// longer answers at its last address, is taken offline: it is removed and its
+// database closed. If it comes back later, its cache is opened again, as are
+// caches opened read-only by OpenOffline.
+func Refresh(tablos []*Tablo, databaseDir string, discoveryMethod string, staticTablos []tabloapi.TabloDetails, offlineAfter time.Duration) ([]*Tablo, error) {
+	logFile, err := openMainLog(databaseDir)
+	if err != nil {
+		return tablos, err
+	}
+	refreshLog := log.New(io.MultiWriter(logFile, os.Stdout), "tablo: ", log.LstdFlags)
+
+	var errMessage strings.Builder
+
+	tabloInfo, err := findTablos(databaseDir, discoveryMethod, staticTablos, refreshLog)
+	if err != nil {
+		refreshLog.Println(err.Error())
+		if len(tabloInfo) == 0 {
+			// nothing was found, so there is no way to tell which Tablos are
+			// missing. leave everything as is until the next refresh
+			return tablos, err
+		}
+		errMessage.WriteString(err.Error())
+	}
+
+	found := make(map[string]tabloapi.TabloDetails)
+	for _, tabloData := range tabloInfo {
+		found[tabloData.ServerID] = tabloData
+	}
+
+	now := time.Now()
+	var current []*Tablo
+	for _, t := range tablos {
+		tabloData, ok := found[t.serverID]
+		delete(found, t.serverID)
+
+		switch {
+		case ok && t.offline:
+			refreshLog.Printf("%s is back. reopening its cache\n", t.serverID)
+			t.Close()
+			tablo, err := openTablo(tabloData, databaseDir, discoveryMethod, logFile, refreshLog)
+			if err != nil {
+				refreshLog.Println(err.Error())
+				errMessage.WriteString(tabloData.ServerID + ": " + err.Error())
+				continue
+			}
+			t = tablo
+		case ok:
+			t.lastSeen = now
+			if tabloData.PrivateIP != "" && tabloData.PrivateIP != t.address() {
+				t.moveTo(tabloData.PrivateIP)
+			}
+		case t.offline:
+			// caches opened by OpenOffline stay read-only until their Tablo is found
+		case now.Sub(t.lastSeen) < offlineAfter:
+			t.log.Printf("not found by discovery. last seen %s\n", t.lastSeen.Format(time.DateTime))
+		default:
+			_, err := getServerInfo(t.address(), t.log)
+			if err == nil {
+				t.log.Printf("not found by discovery but still answering at %s\n", t.address())
+				t.lastSeen = now
+				break
+			}
+
+			refreshLog.Printf("%s has not been seen since %s. taking it offline\n", t.serverID, t.lastSeen.Format(time.DateTime))
+			t.Close()
+			continue
+		}
+
+		current = append(current, t)
+	}
+
+	for _, tabloData := range tabloInfo {
+		if _, ok := found[tabloData.ServerID]; !ok {
+			// already in use, or a duplicate
+			continue
+		}
+		delete(found, tabloData.ServerID)
+
+		refreshLog.Printf("new tablo found: %s (%s) at %s\n", tabloData.Name, tabloData.ServerID, tabloData.PrivateIP)
+		tablo, err := openTablo(tabloData, databaseDir, discoveryMethod, logFile, refreshLog)
+		if err != nil {
+			refreshLog.Println(err.Error())
+			errMessage.WriteString(tabloData.ServerID + ": " + err.Error())
+			continue
+		}
+
+		current = append(current, tablo)
+	}
+
+	if errMessage.String() != "" {
+		return current, errors.New(errMessage.String())
+	}
+
+	return current, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package tablo
+
+import (
+	"errors"
+	"runtime"
+)
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space check not supported on " + runtime.GOOS)
+}
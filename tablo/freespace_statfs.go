@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package tablo
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace returns the bytes available to this user on the filesystem
+// holding path
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, fmt.Errorf("syscall.Statfs error in freeSpace: %v", err)
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
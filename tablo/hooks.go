@@ -0,0 +1,201 @@
+package tablo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+const hookTimeout = 2 * time.Hour
+const hookOutputLimit = 64 * 1024
+const hookWaitDelay = 5 * time.Second
+
+// runExportHooks runs the commands in the exportHook table for the show type
+// of an exported recording. Exports that are suspect only run the hooks that
+// opted in with onSuspect. Each command gets the export's details, including
+// whether it was verified or is suspect, as arguments after its own and as
+// environment variables, and its exit status and output are saved to the
+// queue history. Hook failures do not fail the export.
+func (t *Tablo) runExportHooks(queueRecord tablodb.QueueRecord, recording tablodb.RecordingRecord, exportFile string, verification string) {
+	hooks, err := t.database.GetExportHooks(recording.ShowType)
+	if err != nil {
+		t.log.Println(err)
+		return
+	}
+
+	season := recording.Season
+	episode := ""
+	if recording.Episode != 0 {
+		episode = strconv.Itoa(recording.Episode)
+	}
+	airingID := strconv.Itoa(recording.RecordingID)
+
+	env := append(os.Environ(),
+		"TABLO_EXPORT_FILE="+exportFile,
+		"TABLO_SHOW_TYPE="+recording.ShowType,
+		"TABLO_SHOW_TITLE="+recording.ShowTitle,
+		"TABLO_SEASON="+season,
+		"TABLO_EPISODE="+episode,
+		"TABLO_EPISODE_TITLE="+recording.EpisodeTitle,
+		"TABLO_AIRING_ID="+airingID,
+		"TABLO_SERVER_ID="+t.serverID,
+		"TABLO_VERIFICATION="+verification,
+	)
+
+	for _, hook := range hooks {
+		if verification != "verified" && !hook.OnSuspect {
+			t.log.Printf("%s is %s. skipping export hook %d\n", exportFile, verification, hook.HookID)
+			continue
+		}
+
+		t.log.Printf("running export hook %d: %s\n", hook.HookID, hook.Command)
+
+		history := tablodb.QueueHistoryRecord{
+			QueueID:    queueRecord.QueueID,
+			Action:     "HOOK",
+			Details:    hook.Command,
+			ExportPath: exportFile,
+			Result:     "success",
+			FinishedAt: time.Now(),
+		}
+
+		args, err := splitCommand(hook.Command)
+		if err != nil {
+			history.Result = "failed: " + err.Error()
+			t.log.Printf("export hook %d %s\n", hook.HookID, history.Result)
+			err = t.database.InsertQueueHistory(history)
+			if err != nil {
+				t.log.Println(err)
+			}
+			continue
+		}
+		args = append(args, exportFile, recording.ShowTitle, season, episode, airingID, verification)
+
+		// closing the tablo stops the hook rather than waiting for the timeout
+		ctx, cancel := context.WithTimeout(t.ctx, hookTimeout)
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = env
+		// children the hook started can keep its output open after it is
+		// stopped, so only wait a little while for them
+		cmd.WaitDelay = hookWaitDelay
+		output, err := cmd.CombinedOutput()
+		cancel()
+
+		history.Output = truncateOutput(output)
+		history.FinishedAt = time.Now()
+
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			exitStatus := 0
+			history.ExitStatus = &exitStatus
+		case errors.As(err, &exitErr):
+			exitStatus := exitErr.ExitCode()
+			history.ExitStatus = &exitStatus
+			history.Result = "failed: " + err.Error()
+		default:
+			// the command could not be started at all
+			history.Result = "failed: " + err.Error()
+		}
+
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			history.Result = fmt.Sprintf("failed: timed out after %v", hookTimeout)
+		case t.ctx.Err() != nil:
+			history.Result = "cancelled"
+		}
+
+		t.log.Printf("export hook %d %s\n", hook.HookID, history.Result)
+		err = t.database.InsertQueueHistory(history)
+		if err != nil {
+			t.log.Println(err)
+		}
+
+		if t.ctx.Err() != nil {
+			t.log.Println("tablo is closing. not running the remaining export hooks")
+			return
+		}
+	}
+}
+
+// splitCommand splits a hook command into the program and its arguments.
+// Arguments are separated by spaces or tabs. Single or double quotes keep an
+// argument with spaces in it together and are removed. Backslashes are not
+// special, so Windows paths can be used as they are.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c in hook command %s", quote, command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty hook command")
+	}
+
+	return args, nil
+}
+
+// recordHistory saves the outcome of a queue record to the queue history
+func (t *Tablo) recordHistory(queueRecord tablodb.QueueRecord, result error) {
+	history := tablodb.QueueHistoryRecord{
+		QueueID:    queueRecord.QueueID,
+		Action:     queueRecord.Action,
+		Details:    queueRecord.Details,
+		ExportPath: queueRecord.ExportPath,
+		Result:     "success",
+		FinishedAt: time.Now(),
+	}
+
+	if errors.Is(result, errInsufficientSpace) {
+		history.Result = "waiting: " + result.Error()
+	} else if result != nil {
+		history.Result = "failed: " + result.Error()
+	}
+
+	err := t.database.InsertQueueHistory(history)
+	if err != nil {
+		t.log.Println(err)
+	}
+}
+
+// truncateOutput keeps the end of long hook output, where errors usually are
+func truncateOutput(output []byte) string {
+	if len(output) > hookOutputLimit {
+		output = output[len(output)-hookOutputLimit:]
+	}
+	return string(output)
+}
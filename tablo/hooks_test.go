@@ -0,0 +1,108 @@
+package tablo
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "program only",
+			command: "/usr/local/bin/refresh-library",
+			want:    []string{"/usr/local/bin/refresh-library"},
+		},
+		{
+			name:    "arguments",
+			command: "curl -X POST http://jellyfin:8096/Library/Refresh",
+			want:    []string{"curl", "-X", "POST", "http://jellyfin:8096/Library/Refresh"},
+		},
+		{
+			name:    "extra spaces and tabs",
+			command: "  sha256sum \t -b  ",
+			want:    []string{"sha256sum", "-b"},
+		},
+		{
+			name:    "double quotes",
+			command: `"C:\Program Files\Hooks\checksum.exe" -b`,
+			want:    []string{`C:\Program Files\Hooks\checksum.exe`, "-b"},
+		},
+		{
+			name:    "single quotes inside an argument",
+			command: `curl -H 'X-Emby-Token: abc'`,
+			want:    []string{"curl", "-H", "X-Emby-Token: abc"},
+		},
+		{
+			name:    "quoted empty argument",
+			command: `hook ""`,
+			want:    []string{"hook", ""},
+		},
+		{
+			name:    "unterminated quote",
+			command: `hook "one two`,
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			command: " ",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitCommand(%q) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunExportHooksCancelled(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run a hook with")
+	}
+
+	fake, _ := newGuideTablo(t)
+	tablo, cache := newTestTablo(t, fake)
+
+	hook := sh + ` -c "exec sleep 60"`
+	_, err = cache.Exec("INSERT INTO exportHook (command) VALUES (?), (?)", hook, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tablo.cancel()
+	}()
+
+	start := time.Now()
+	queueRecord := tablodb.QueueRecord{QueueID: 1, Action: "EXPORT", Details: "500"}
+	recording := tablodb.RecordingRecord{RecordingID: 500, ShowType: "series"}
+	tablo.runExportHooks(queueRecord, recording, "/exports/show.mkv", "verified")
+
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("hooks ran for %v after the tablo was closed", elapsed)
+	}
+	if got := queryInt(t, cache, "SELECT count(*) FROM queueHistory"); got != 1 {
+		t.Errorf("%d hooks recorded, want only the cancelled one", got)
+	}
+	if got := queryInt(t, cache, "SELECT count(*) FROM queueHistory WHERE result = 'cancelled'"); got != 1 {
+		t.Errorf("running hook not recorded as cancelled")
+	}
+}
@@ -0,0 +1,241 @@
+package tablo
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+// libraryItem is what can be worked out about a recording from the name of a
+// file in the export path. Fields that could not be found are left at their
+// zero value (-1 for season and episode).
+type libraryItem struct {
+	file    string
+	show    string
+	season  int
+	episode int
+	airDate string
+	year    int
+	name    string
+}
+
+type ambiguousMatch struct {
+	file      string
+	airingIDs []int
+}
+
+var videoExtensions = map[string]bool{
+	".avi":  true,
+	".m2ts": true,
+	".m4v":  true,
+	".mkv":  true,
+	".mov":  true,
+	".mp4":  true,
+	".mpeg": true,
+	".mpg":  true,
+	".ts":   true,
+	".webm": true,
+	".wmv":  true,
+}
+
+// isVideo reports whether file has one of the videoExtensions, as opposed to
+// a sidecar like .nfo or .edl, or an export still in progress
+func isVideo(file string) bool {
+	return videoExtensions[strings.ToLower(filepath.Ext(file))]
+}
+
+var seasonEpisodePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])s(\d{1,4})\s*e(\d{1,12})(?:[^0-9]|$)|(?:^|[^0-9])(\d{1,2})x(\d{2,3})(?:[^0-9]|$)`)
+var airDatePattern = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)\d{2})[-. ](\d{2})[-. ](\d{2})(?:[^0-9]|$)`)
+var yearPattern = regexp.MustCompile(`(?:^|[^0-9])\(?((?:19|20)\d{2})\)?(?:[^0-9]|$)`)
+var leadingArticlePattern = regexp.MustCompile(`^the[^\pL\pN]+`)
+var seasonFolderPattern = regexp.MustCompile(`(?i)^(season\s*\d+|specials)$`)
+
+// matchLibrary matches files found in the export path to scheduled airings by
+// show, season/episode or air date, year, and sports event rather than by exact
+// filename.
+// Files that match airings of more than one distinct episode or movie, and
+// movie files with no year that match more than one airing, are reported as
+// ambiguous and not matched.
+func matchLibrary(files []string, airings []tablodb.ScheduledAiringRecord) (map[int]string, []ambiguousMatch) {
+	matched := make(map[int]string)
+	var ambiguous []ambiguousMatch
+
+	for _, f := range files {
+		if !isVideo(f) {
+			continue
+		}
+
+		item := parseLibraryFile(f)
+		if item.show == "" {
+			continue
+		}
+
+		identities := make(map[string]bool)
+		showTypes := make(map[int]string)
+		var airingIDs []int
+		movies := 0
+		for _, a := range airings {
+			identity, ok := matchIdentity(item, a)
+			if !ok {
+				continue
+			}
+			identities[identity] = true
+			showTypes[a.AiringID] = a.ShowType
+			airingIDs = append(airingIDs, a.AiringID)
+			if a.ShowType == "movies" {
+				movies++
+			}
+		}
+
+		// a movie file with no year cannot be told apart from a remake or a
+		// later airing, so it is only matched when the title airs just once
+		if len(identities) > 1 || item.year == 0 && movies > 1 {
+			sort.Ints(airingIDs)
+			ambiguous = append(ambiguous, ambiguousMatch{file: f, airingIDs: airingIDs})
+			continue
+		}
+
+		for _, id := range airingIDs {
+			matched[id] = showTypes[id]
+		}
+	}
+
+	return matched, ambiguous
+}
+
+// matchIdentity returns the identity of the episode or movie shared by the
+// file and the airing, if they are the same
+func matchIdentity(item libraryItem, airing tablodb.ScheduledAiringRecord) (string, bool) {
+	show := normalizeTitle(airing.ShowTitle)
+
+	if airing.ShowType == "sports" && airing.EpisodeTitle != "" {
+		// the default sports layout, {show} - {season} - {title}, has no air date
+		// or episode number, so the whole name is the identity
+		values := templateValues(airing)
+		event := normalizeTitle(values["season"] + values["title"])
+		if item.name == normalizeTitle(values["show"]+values["season"]+values["title"]) {
+			return show + "|" + event, true
+		}
+	}
+
+	if item.show != show && (item.season < 0 || item.show+strconv.Itoa(item.year) != show) {
+		// Show (2019) - s01e01 may be called either Show or Show (2019) on the Tablo
+		return "", false
+	}
+
+	airDate := time.Unix(int64(airing.AirDate), 0).Format("2006-01-02")
+
+	switch airing.ShowType {
+	case "series":
+		season, err := strconv.Atoi(airing.Season)
+		if err == nil && airing.Episode != 0 && item.season == season && item.episode == airing.Episode {
+			return show + "|s" + strconv.Itoa(season) + "e" + strconv.Itoa(airing.Episode), true
+		}
+
+		if item.airDate == "" {
+			return "", false
+		}
+
+		if airing.OrigAirDate != 0 && item.airDate == time.Unix(int64(airing.OrigAirDate), 0).Format("2006-01-02") {
+			return show + "|" + item.airDate, true
+		}
+
+		if item.airDate == airDate {
+			return show + "|" + item.airDate, true
+		}
+	case "movies":
+		if item.season >= 0 || item.airDate != "" {
+			return "", false
+		}
+
+		if item.year == 0 || item.year == airing.ReleaseYear {
+			return show + "|" + strconv.Itoa(airing.ReleaseYear), true
+		}
+	case "sports":
+		if item.airDate == airDate {
+			return show + "|" + airDate, true
+		}
+	}
+
+	return "", false
+}
+
+func parseLibraryFile(file string) libraryItem {
+	item := libraryItem{file: file, season: -1, episode: -1}
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	title := base
+	item.name = normalizeTitle(base)
+
+	if m := seasonEpisodePattern.FindStringSubmatchIndex(base); m != nil {
+		var season, episode string
+		if m[2] >= 0 {
+			season, episode = base[m[2]:m[3]], base[m[4]:m[5]] // sNNeNN
+		} else {
+			season, episode = base[m[6]:m[7]], base[m[8]:m[9]] // NNxNN
+		}
+		title = base[:m[0]]
+
+		if len(episode) == 12 {
+			// airings without episode numbers are exported as sNNeYYYYMMDDhhmm
+			airDate, err := time.ParseInLocation("200601021504", episode, time.Local)
+			if err == nil {
+				item.airDate = airDate.Format("2006-01-02")
+			}
+		} else {
+			item.season, _ = strconv.Atoi(season)
+			item.episode, _ = strconv.Atoi(episode)
+		}
+	} else if m := airDatePattern.FindStringSubmatchIndex(base); m != nil {
+		item.airDate = base[m[2]:m[3]] + "-" + base[m[4]:m[5]] + "-" + base[m[6]:m[7]]
+		title = base[:m[0]]
+	} else if m := yearPattern.FindAllStringSubmatchIndex(base, -1); m != nil {
+		// the last year is the release year. earlier ones are part of the title
+		last := m[len(m)-1]
+		item.year, _ = strconv.Atoi(base[last[2]:last[3]])
+		if last[0] > 0 {
+			title = base[:last[0]]
+		} else {
+			title = ""
+		}
+	}
+
+	title = strings.TrimRight(title, " -._")
+	if m := yearPattern.FindStringSubmatchIndex(title); m != nil && item.year == 0 && m[1] == len(title) {
+		// Show (2019) - s01e01
+		item.year, _ = strconv.Atoi(title[m[2]:m[3]])
+		title = title[:m[0]]
+	}
+
+	item.show = normalizeTitle(title)
+	if item.show == "" {
+		folder := filepath.Base(filepath.Dir(file))
+		if seasonFolderPattern.MatchString(folder) {
+			folder = filepath.Base(filepath.Dir(filepath.Dir(file)))
+		}
+		item.show = normalizeTitle(folder)
+	}
+
+	return item
+}
+
+// normalizeTitle reduces a title to lowercase letters and digits so that
+// punctuation, capitalization and filename sanitization do not matter
+func normalizeTitle(title string) string {
+	title = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(title, "&", "and")))
+	title = leadingArticlePattern.ReplaceAllString(title, "")
+
+	var normalized strings.Builder
+	for _, r := range title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			normalized.WriteRune(r)
+		}
+	}
+
+	return normalized.String()
+}
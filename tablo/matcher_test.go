@@ -0,0 +1,210 @@
+package tablo
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+func localUnix(year int, month time.Month, day int, hour int, min int) int {
+	return int(time.Date(year, month, day, hour, min, 0, 0, time.Local).Unix())
+}
+
+func TestParseLibraryFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want libraryItem
+	}{
+		{
+			name: "sNNeNN",
+			file: "TV/The Office/Season 02/The Office - s02e03 - Office Olympics.mp4",
+			want: libraryItem{show: "office", season: 2, episode: 3},
+		},
+		{
+			name: "scene style sNNeNN",
+			file: "Doctor.Who.S03E07.720p.mkv",
+			want: libraryItem{show: "doctorwho", season: 3, episode: 7},
+		},
+		{
+			name: "NxNN",
+			file: "TV/Doctor Who/Doctor Who 3x07.mkv",
+			want: libraryItem{show: "doctorwho", season: 3, episode: 7},
+		},
+		{
+			name: "sNNe with air date and time",
+			file: "TV/Jeopardy!/Season 00/Jeopardy! - s00e202403041930.mp4",
+			want: libraryItem{show: "jeopardy", season: -1, episode: -1, airDate: "2024-03-04"},
+		},
+		{
+			name: "air date",
+			file: "TV/The Daily Show/The Daily Show 2024.03.04.ts",
+			want: libraryItem{show: "dailyshow", season: -1, episode: -1, airDate: "2024-03-04"},
+		},
+		{
+			name: "year",
+			file: "Movies/Dune - 2021.mp4",
+			want: libraryItem{show: "dune", season: -1, episode: -1, year: 2021},
+		},
+		{
+			name: "year in title",
+			file: "Movies/Blade Runner 2049 (2017).mkv",
+			want: libraryItem{show: "bladerunner2049", season: -1, episode: -1, year: 2017},
+		},
+		{
+			name: "year before sNNeNN",
+			file: "TV/Dexter (2006)/Season 01/Dexter (2006) - s01e01.mp4",
+			want: libraryItem{show: "dexter", season: 1, episode: 1, year: 2006},
+		},
+		{
+			name: "title from folder",
+			file: "TV/Cosmos & Friends/Season 01/s01e02.mp4",
+			want: libraryItem{show: "cosmosandfriends", season: 1, episode: 2},
+		},
+		{
+			name: "sports",
+			file: "Sports/NFL Football/NFL Football - 2024 - Bears at Packers.mp4",
+			want: libraryItem{show: "nflfootball", season: -1, episode: -1, year: 2024},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.FromSlash(tt.file)
+			got := parseLibraryFile(file)
+			got.name = ""
+
+			tt.want.file = file
+			if got != tt.want {
+				t.Errorf("parseLibraryFile(%q) = %+v, want %+v", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchLibrary(t *testing.T) {
+	airings := []tablodb.ScheduledAiringRecord{
+		{AiringID: 1, ShowType: "series", ShowTitle: "The Office", Season: "2", Episode: 3, AirDate: localUnix(2024, 3, 4, 20, 0)},
+		{AiringID: 2, ShowType: "series", ShowTitle: "The Office", Season: "2", Episode: 3, AirDate: localUnix(2024, 3, 11, 20, 0)},
+		{AiringID: 3, ShowType: "series", ShowTitle: "The Office", Season: "2", Episode: 4, AirDate: localUnix(2024, 3, 18, 20, 0)},
+		{AiringID: 4, ShowType: "series", ShowTitle: "Doctor Who", Season: "3", Episode: 7, AirDate: localUnix(2024, 3, 5, 19, 0)},
+		{AiringID: 5, ShowType: "series", ShowTitle: "Jeopardy!", AirDate: localUnix(2024, 3, 4, 19, 30)},
+		{AiringID: 6, ShowType: "series", ShowTitle: "The Daily Show", AirDate: localUnix(2024, 3, 6, 23, 0), OrigAirDate: localUnix(2024, 3, 4, 0, 0)},
+		{AiringID: 7, ShowType: "series", ShowTitle: "Dexter", Season: "1", Episode: 1, AirDate: localUnix(2024, 3, 7, 22, 0)},
+		{AiringID: 8, ShowType: "movies", ShowTitle: "Dune", ReleaseYear: 2021, AirDate: localUnix(2024, 3, 8, 20, 0)},
+		{AiringID: 9, ShowType: "movies", ShowTitle: "Dune", ReleaseYear: 1984, AirDate: localUnix(2024, 3, 9, 20, 0)},
+		{AiringID: 10, ShowType: "sports", ShowTitle: "NFL Football", Season: "2024", EpisodeTitle: "Bears at Packers", AirDate: localUnix(2024, 9, 8, 13, 0)},
+		{AiringID: 11, ShowType: "sports", ShowTitle: "NFL Football", Season: "2024", EpisodeTitle: "Lions at Bears", AirDate: localUnix(2024, 9, 15, 13, 0)},
+		{AiringID: 12, ShowType: "sports", ShowTitle: "College Basketball", AirDate: localUnix(2024, 3, 10, 12, 0)},
+		{AiringID: 13, ShowType: "movies", ShowTitle: "Heat", ReleaseYear: 1995, AirDate: localUnix(2024, 3, 11, 20, 0)},
+		{AiringID: 14, ShowType: "movies", ShowTitle: "Arrival", ReleaseYear: 2016, AirDate: localUnix(2024, 3, 12, 20, 0)},
+		{AiringID: 15, ShowType: "movies", ShowTitle: "Arrival", ReleaseYear: 2016, AirDate: localUnix(2024, 3, 19, 20, 0)},
+	}
+
+	tests := []struct {
+		name          string
+		files         []string
+		wantMatched   map[int]string
+		wantAmbiguous []ambiguousMatch
+	}{
+		{
+			name:        "sNNeNN matches every airing of the episode",
+			files:       []string{"TV/The Office/Season 02/the office - S02E03.mkv"},
+			wantMatched: map[int]string{1: "series", 2: "series"},
+		},
+		{
+			name:        "NxNN",
+			files:       []string{"Doctor.Who.3x07.mp4"},
+			wantMatched: map[int]string{4: "series"},
+		},
+		{
+			name:        "air date and time",
+			files:       []string{"TV/Jeopardy!/Season 00/Jeopardy! - s00e202403041930.mp4"},
+			wantMatched: map[int]string{5: "series"},
+		},
+		{
+			name:        "original air date",
+			files:       []string{"The.Daily.Show.2024-03-04.ts"},
+			wantMatched: map[int]string{6: "series"},
+		},
+		{
+			name:        "show with year",
+			files:       []string{"TV/Dexter (2006)/Season 01/Dexter (2006) - s01e01.mp4"},
+			wantMatched: map[int]string{7: "series"},
+		},
+		{
+			name:        "movie year",
+			files:       []string{"Movies/Dune - 2021.mp4"},
+			wantMatched: map[int]string{8: "movies"},
+		},
+		{
+			name:          "movie without year is ambiguous",
+			files:         []string{"Movies/Dune.mkv"},
+			wantMatched:   map[int]string{},
+			wantAmbiguous: []ambiguousMatch{{file: "Movies/Dune.mkv", airingIDs: []int{8, 9}}},
+		},
+		{
+			name:        "movie without year that airs once",
+			files:       []string{"Movies/Heat.mkv"},
+			wantMatched: map[int]string{13: "movies"},
+		},
+		{
+			name:          "movie without year that airs more than once is ambiguous",
+			files:         []string{"Movies/Arrival.mkv"},
+			wantMatched:   map[int]string{},
+			wantAmbiguous: []ambiguousMatch{{file: "Movies/Arrival.mkv", airingIDs: []int{14, 15}}},
+		},
+		{
+			name:        "movie year matches every airing of the movie",
+			files:       []string{"Movies/Arrival (2016).mkv"},
+			wantMatched: map[int]string{14: "movies", 15: "movies"},
+		},
+		{
+			name:        "sports event title",
+			files:       []string{"Sports/NFL Football/NFL Football - 2024 - Bears at Packers.mp4"},
+			wantMatched: map[int]string{10: "sports"},
+		},
+		{
+			name:        "sports air date",
+			files:       []string{"College Basketball 2024-03-10.mp4"},
+			wantMatched: map[int]string{12: "sports"},
+		},
+		{
+			name: "no match",
+			files: []string{
+				"TV/The Office/Season 02/The Office - s02e05.mp4",
+				"Movies/Dune - 2000.mp4",
+				"Sports/NFL Football/NFL Football - 2024 - Bears at Lions.mp4",
+			},
+			wantMatched: map[int]string{},
+		},
+		{
+			name:        "sidecar files are ignored",
+			files:       []string{"TV/The Office/Season 02/The Office - s02e04.nfo"},
+			wantMatched: map[int]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			for _, f := range tt.files {
+				files = append(files, filepath.FromSlash(f))
+			}
+			for i := range tt.wantAmbiguous {
+				tt.wantAmbiguous[i].file = filepath.FromSlash(tt.wantAmbiguous[i].file)
+			}
+
+			matched, ambiguous := matchLibrary(files, airings)
+			if !reflect.DeepEqual(matched, tt.wantMatched) {
+				t.Errorf("matched = %v, want %v", matched, tt.wantMatched)
+			}
+			if !reflect.DeepEqual(ambiguous, tt.wantAmbiguous) {
+				t.Errorf("ambiguous = %+v, want %+v", ambiguous, tt.wantAmbiguous)
+			}
+		})
+	}
+}
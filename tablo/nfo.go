@@ -0,0 +1,207 @@
+package tablo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+type nfoActor struct {
+	Name string `xml:"name"`
+}
+
+type nfoTVShow struct {
+	XMLName   xml.Name   `xml:"tvshow"`
+	Title     string     `xml:"title"`
+	Plot      string     `xml:"plot,omitempty"`
+	Premiered string     `xml:"premiered,omitempty"`
+	Year      string     `xml:"year,omitempty"`
+	Runtime   int        `xml:"runtime,omitempty"`
+	MPAA      string     `xml:"mpaa,omitempty"`
+	Genres    []string   `xml:"genre"`
+	Tags      []string   `xml:"tag"`
+	Actors    []nfoActor `xml:"actor"`
+}
+
+type nfoEpisode struct {
+	XMLName   xml.Name `xml:"episodedetails"`
+	Title     string   `xml:"title"`
+	ShowTitle string   `xml:"showtitle"`
+	Season    string   `xml:"season,omitempty"`
+	Episode   string   `xml:"episode,omitempty"`
+	Plot      string   `xml:"plot,omitempty"`
+	Aired     string   `xml:"aired,omitempty"`
+}
+
+type nfoMovie struct {
+	XMLName   xml.Name   `xml:"movie"`
+	Title     string     `xml:"title"`
+	Plot      string     `xml:"plot,omitempty"`
+	Year      string     `xml:"year,omitempty"`
+	Premiered string     `xml:"premiered,omitempty"`
+	Runtime   int        `xml:"runtime,omitempty"`
+	MPAA      string     `xml:"mpaa,omitempty"`
+	Genres    []string   `xml:"genre"`
+	Directors []string   `xml:"director"`
+	Tags      []string   `xml:"tag"`
+	Actors    []nfoActor `xml:"actor"`
+}
+
+// writeNFO writes Kodi/Jellyfin sidecar metadata for an exported recording.
+// Episode and movie NFOs sit next to the exported file. tvshow.nfo is written
+// to the show folder only when one does not already exist, so edits made in
+// the media server are kept.
+func (t *Tablo) writeNFO(recording tablodb.RecordingRecord, exportPath string, exportFile string) error {
+	show, err := t.database.GetShowMetadata(recording.ShowID)
+	if err != nil {
+		return err
+	}
+
+	nfoFile := strings.TrimSuffix(exportFile, filepath.Ext(exportFile)) + ".nfo"
+
+	switch recording.ShowType {
+	case "movies":
+		t.log.Printf("writing %s\n", nfoFile)
+		return t.writeXML(nfoFile, newNFOMovie(show))
+	case "series", "sports":
+		showFile := joinExportPath(getShowFolder(recordingToAiring(recording), exportPath, t.exportTemplates), "tvshow.nfo")
+		exists, err := t.exportFileExists(showFile)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			t.log.Printf("writing %s\n", showFile)
+			err = t.writeXML(showFile, newNFOTVShow(show))
+			if err != nil {
+				return err
+			}
+		}
+
+		episode := tablodb.EpisodeMetadataRecord{Title: recording.EpisodeTitle}
+		if recording.EpisodeID != "" {
+			episode, err = t.database.GetEpisodeMetadata(recording.EpisodeID)
+			if err != nil {
+				return err
+			}
+		}
+
+		t.log.Printf("writing %s\n", nfoFile)
+		return t.writeXML(nfoFile, newNFOEpisode(show, episode, recording))
+	default:
+		return fmt.Errorf("no nfo format for show type %s", recording.ShowType)
+	}
+}
+
+func newNFOTVShow(show tablodb.ShowMetadataRecord) nfoTVShow {
+	nfo := nfoTVShow{
+		Title:   show.Title,
+		Plot:    show.Description,
+		Runtime: show.OrigRunTime / 60,
+		MPAA:    show.Rating,
+		Genres:  show.Genres,
+		Tags:    awardTags(show.Awards),
+		Actors:  actors(show.Cast),
+	}
+
+	if show.ReleaseDate != 0 {
+		premiered := time.Unix(int64(show.ReleaseDate), 0)
+		nfo.Premiered = premiered.Format("2006-01-02")
+		nfo.Year = strconv.Itoa(premiered.Year())
+	}
+
+	return nfo
+}
+
+func newNFOEpisode(show tablodb.ShowMetadataRecord, episode tablodb.EpisodeMetadataRecord, recording tablodb.RecordingRecord) nfoEpisode {
+	nfo := nfoEpisode{
+		Title:     episode.Title,
+		ShowTitle: show.Title,
+		Plot:      episode.Description,
+	}
+
+	if nfo.Title == "" {
+		nfo.Title = show.Title
+	}
+
+	// sports seasons are years or names rather than season numbers
+	if _, err := strconv.Atoi(episode.Season); err == nil && recording.ShowType == "series" {
+		nfo.Season = episode.Season
+	}
+
+	if episode.Episode != 0 {
+		nfo.Episode = strconv.Itoa(episode.Episode)
+	}
+
+	aired := recording.AirDate
+	if episode.OriginalAirDate != 0 {
+		aired = episode.OriginalAirDate
+	}
+	if aired != 0 {
+		nfo.Aired = time.Unix(int64(aired), 0).Format("2006-01-02")
+	}
+
+	return nfo
+}
+
+func newNFOMovie(show tablodb.ShowMetadataRecord) nfoMovie {
+	nfo := nfoMovie{
+		Title:     show.Title,
+		Plot:      show.Description,
+		Runtime:   show.OrigRunTime / 60,
+		MPAA:      show.Rating,
+		Genres:    show.Genres,
+		Directors: show.Directors,
+		Tags:      awardTags(show.Awards),
+		Actors:    actors(show.Cast),
+	}
+
+	if show.ReleaseDate != 0 {
+		nfo.Year = strconv.Itoa(time.Unix(int64(show.ReleaseDate), 0).Year())
+	}
+
+	return nfo
+}
+
+// awardTags flattens awards into tags since neither Kodi nor Jellyfin have an
+// award element
+func awardTags(awards []tablodb.AwardRecord) []string {
+	var tags []string
+	for _, a := range awards {
+		result := "nominated"
+		if a.Won {
+			result = "won"
+		}
+		tag := fmt.Sprintf("%s %d %s (%s)", a.Name, a.Year, a.Category, result)
+		if a.Nominee != "" {
+			tag += " - " + a.Nominee
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func actors(cast []string) []nfoActor {
+	var out []nfoActor
+	for _, c := range cast {
+		out = append(out, nfoActor{Name: c})
+	}
+	return out
+}
+
+func (t *Tablo) writeXML(file string, v any) error {
+	output, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("xml.MarshalIndent error in writeXML: %v", err)
+	}
+
+	output = append([]byte(xml.Header), output...)
+	output = append(output, '\n')
+
+	return t.writeExportFile(file, output)
+}
@@ -0,0 +1,213 @@
+package tablo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+var errOffline = errors.New("tablo is offline. its cache is read-only")
+
+// OpenOffline opens every SID_*.cache in databaseDir read-only, for when no
+// Tablo can be reached. The caches can be read but nothing is synced or
+// exported until the Tablos are back.
+func OpenOffline(databaseDir string) ([]*Tablo, error) {
+	logFile, err := openMainLog(databaseDir)
+	if err != nil {
+		return nil, err
+	}
+	offlineLog := log.New(io.MultiWriter(logFile, os.Stdout), "tablo: ", log.LstdFlags)
+
+	offlineLog.Println("opening existing caches read-only")
+	files, err := os.ReadDir(databaseDir)
+	if err != nil {
+		offlineLog.Println(err)
+		return nil, fmt.Errorf("os.ReadDir error in OpenOffline: %v", err)
+	}
+
+	var tablos []*Tablo
+	var errMessage strings.Builder
+	for _, f := range files {
+		fileName := f.Name()
+		if f.IsDir() || !strings.HasPrefix(fileName, "SID_") || !strings.HasSuffix(fileName, ".cache") {
+			continue
+		}
+		serverID := strings.TrimSuffix(fileName, ".cache")
+
+		tablo, err := openOffline(serverID, databaseDir, logFile)
+		if err != nil {
+			offlineLog.Println(err)
+			errMessage.WriteString(serverID + ": " + err.Error())
+			continue
+		}
+
+		tablos = append(tablos, tablo)
+	}
+
+	if len(tablos) == 0 {
+		if errMessage.String() != "" {
+			return nil, errors.New(errMessage.String())
+		}
+		return nil, fmt.Errorf("no caches found in %s", databaseDir)
+	}
+
+	offlineLog.Printf("%d caches opened read-only\n", len(tablos))
+	return tablos, nil
+}
+
+func openOffline(serverID string, databaseDir string, logFile io.Writer) (*Tablo, error) {
+	database, err := tablodb.OpenReadOnly(serverID, databaseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	_, name, ipAddress, err := database.GetSystemInfo()
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	tablo := &Tablo{
+		name:     name,
+		serverID: serverID,
+		database: database,
+		log:      log.New(io.MultiWriter(logFile, os.Stdout), "tablo "+serverID+": ", log.LstdFlags),
+		offline:  true,
+		lastSeen: time.Unix(0, 0),
+	}
+	tablo.exports = newExporter(1, 0, tablo.runExport)
+	tablo.api = tablo.newAPI(ipAddress, 0, 0)
+	tablo.ctx, tablo.cancel = context.WithCancel(context.Background())
+
+	tablo.guideLastUpdated, tablo.scheduledLastUpdated, tablo.recordingsLastUpdated, err = database.GetLastUpdated()
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	tablo.defaultExportPath, err = database.GetDefaultExportPath()
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	tablo.exportTemplates, err = database.GetExportTemplates()
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return tablo, nil
+}
+
+// Offline reports whether the Tablo's cache was opened read-only by
+// OpenOffline
+func (t *Tablo) Offline() bool {
+	return t.offline
+}
+
+// LastUpdated returns when the guide, scheduled airings and recordings in the
+// cache were last synced with the Tablo, so readers of an offline cache know
+// how stale it is
+func (t *Tablo) LastUpdated() (time.Time, time.Time, time.Time) {
+	return t.guideLastUpdated, t.scheduledLastUpdated, t.recordingsLastUpdated
+}
+
+// The accessors below only read the cache, so they work the same whether the
+// Tablo is online or was opened by OpenOffline.
+
+// ScheduledAirings returns the airings the Tablo is set to record, including
+// those in conflict
+func (t *Tablo) ScheduledAirings() ([]tablodb.ScheduledAiringRecord, error) {
+	airings, err := t.database.GetScheduledAirings()
+	if err != nil {
+		t.log.Println(err)
+		return nil, err
+	}
+	return airings, nil
+}
+
+// Recordings returns every recording on the Tablo, oldest first
+func (t *Tablo) Recordings() ([]tablodb.RecordingRecord, error) {
+	recordings, err := t.database.GetRecordings()
+	if err != nil {
+		t.log.Println(err)
+		return nil, err
+	}
+	return recordings, nil
+}
+
+// Queue returns the queue records waiting to be processed
+func (t *Tablo) Queue() ([]tablodb.QueueRecord, error) {
+	queue, err := t.database.GetQueue()
+	if err != nil {
+		t.log.Println(err)
+		return nil, err
+	}
+	return queue, nil
+}
+
+// Exported returns the path of every export found in the export paths
+func (t *Tablo) Exported() ([]string, error) {
+	exported, err := t.database.GetExported()
+	if err != nil {
+		t.log.Println(err)
+		return nil, err
+	}
+	return exported, nil
+}
+
+// Alerts returns the alerts that have not been cleared
+func (t *Tablo) Alerts() ([]tablodb.AlertRecord, error) {
+	alerts, err := t.database.GetOpenAlerts()
+	if err != nil {
+		t.log.Println(err)
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// Report summarizes what is in the cache: how much is scheduled, recorded,
+// queued and exported, when it was last synced and any open alerts
+func (t *Tablo) Report() (string, error) {
+	airings, err := t.ScheduledAirings()
+	if err != nil {
+		return "", err
+	}
+
+	recordings, err := t.Recordings()
+	if err != nil {
+		return "", err
+	}
+
+	queue, err := t.Queue()
+	if err != nil {
+		return "", err
+	}
+
+	exported, err := t.Exported()
+	if err != nil {
+		return "", err
+	}
+
+	alerts, err := t.Alerts()
+	if err != nil {
+		return "", err
+	}
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "%s: %d scheduled airings, %d recordings, %d queue records, %d exports. recordings last synced %s",
+		t.name, len(airings), len(recordings), len(queue), len(exported), t.recordingsLastUpdated.Format(time.DateTime))
+	for _, a := range alerts {
+		fmt.Fprintf(&report, "\n%s alert since %s: %s", a.AlertType, a.RaisedAt.Format(time.DateTime), a.Message)
+	}
+
+	return report.String(), nil
+}
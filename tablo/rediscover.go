@@ -0,0 +1,66 @@
+package tablo
+
+import "time"
+
+// rediscoverInterval is how long discovery is not run again after a failed
+// rediscovery, so requests that fail together don't each repeat it
+const rediscoverInterval = time.Minute
+
+// address returns the Tablo's current IP address, which can change at any time
+// if the Tablo is rediscovered
+func (t *Tablo) address() string {
+	return t.api.Address()
+}
+
+// rediscover looks for the Tablo at a new address after it stopped responding
+// at oldIP. It returns true if the Tablo's address has changed. Requests that
+// were waiting on a rediscovery use its result instead of running their own.
+func (t *Tablo) rediscover(oldIP string) bool {
+	t.rediscoverLock.Lock()
+	defer t.rediscoverLock.Unlock()
+
+	if t.address() != oldIP {
+		// another request already found the new address
+		return true
+	}
+
+	if since := time.Since(t.lastRediscovery); since < rediscoverInterval {
+		t.log.Printf("unable to connect to %s. discovery ran %v ago. not running it again\n", oldIP, since.Round(time.Second))
+		return false
+	}
+
+	t.log.Printf("unable to connect to %s. running discovery\n", oldIP)
+	tablos, err := discover(t.discoveryMethod, t.log)
+	t.lastRediscovery = time.Now()
+	if err != nil {
+		t.log.Println(err)
+	}
+
+	for _, tabloData := range tablos {
+		if tabloData.ServerID != t.serverID {
+			continue
+		}
+
+		if tabloData.PrivateIP == "" || tabloData.PrivateIP == oldIP {
+			t.log.Printf("tablo is still at %s\n", oldIP)
+			return false
+		}
+
+		t.moveTo(tabloData.PrivateIP)
+		return true
+	}
+
+	t.log.Println("tablo not found by discovery")
+	return false
+}
+
+// moveTo switches the Tablo to a new IP address and saves it to the cache
+func (t *Tablo) moveTo(ipAddress string) {
+	t.log.Printf("tablo moved from %s to %s\n", t.address(), ipAddress)
+	t.api.SetAddress(ipAddress)
+
+	err := t.database.UpdatePrivateIP(ipAddress)
+	if err != nil {
+		t.log.Println(err)
+	}
+}
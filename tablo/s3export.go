@@ -0,0 +1,191 @@
+package tablo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/davidw1457/tablo-manager/s3store"
+	"github.com/davidw1457/tablo-manager/tablodb"
+)
+
+// s3Client returns the client for s3:// export paths, creating it from the
+// AWS environment variables the first time it is needed
+func (t *Tablo) s3Client() (*s3store.Client, error) {
+	t.s3Lock.Lock()
+	defer t.s3Lock.Unlock()
+
+	if t.s3 == nil {
+		client, err := s3store.NewFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		t.s3 = client
+	}
+
+	return t.s3, nil
+}
+
+// uploadRecording streams the segments of a recording into a multipart upload,
+// through ffmpeg when they are remuxed into format (with chapters, as for local
+// exports). Unlike local exports there is no checkpointing. An interrupted
+// upload is aborted and starts again from the first segment.
+func (t *Tablo) uploadRecording(recording tablodb.RecordingRecord, exportFile string, segments []hlsSegment, format string, chapters string) (tablodb.ExportedRecord, error) {
+	client, err := t.s3Client()
+	if err != nil {
+		return tablodb.ExportedRecord{}, err
+	}
+
+	t.log.Printf("uploading %d segments to %s\n", len(segments), exportFile)
+	upload, err := client.Create(exportFile)
+	if err != nil {
+		return tablodb.ExportedRecord{}, err
+	}
+
+	var w io.Writer = upload
+	var remuxer *remuxWriter
+	if format != "" {
+		remuxer, err = startRemux(upload, format, chapters)
+		if err != nil {
+			abortErr := upload.Abort()
+			if abortErr != nil {
+				t.log.Println(abortErr)
+			}
+			return tablodb.ExportedRecord{}, err
+		}
+		w = remuxer
+	}
+
+	var downloaded int64
+	for _, s := range segments {
+		data, err := t.api.Fetch(t.ctx, s.uri, t.exports.limiter.reader)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+
+		if err != nil {
+			if remuxer != nil {
+				remuxer.Close()
+			}
+			abortErr := upload.Abort()
+			if abortErr != nil {
+				t.log.Println(abortErr)
+			}
+			return tablodb.ExportedRecord{}, err
+		}
+		downloaded += int64(len(data))
+	}
+
+	if remuxer != nil {
+		err = remuxer.Close()
+		if err != nil {
+			abortErr := upload.Abort()
+			if abortErr != nil {
+				t.log.Println(abortErr)
+			}
+			return tablodb.ExportedRecord{}, err
+		}
+	}
+
+	err = upload.Close()
+	if err != nil {
+		abortErr := upload.Abort()
+		if abortErr != nil {
+			t.log.Println(abortErr)
+		}
+		return tablodb.ExportedRecord{}, err
+	}
+
+	size, err := client.Size(exportFile)
+	if err != nil {
+		return tablodb.ExportedRecord{}, err
+	}
+
+	// ffprobe cannot read from the bucket, so the playlist has the only duration
+	t.log.Printf("verifying %s\n", exportFile)
+	return t.verifyExport(exportFile, recording, downloaded, size, playlistDuration(segments))
+}
+
+// checkExportedS3 is checkExported for an s3:// export path. Only exported
+// records under path are checked, since the bucket listing says nothing about
+// files exported anywhere else.
+func (t *Tablo) checkExportedS3(toCheck []string, path string, roots []string) ([]string, []string, error) {
+	client, err := t.s3Client()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var exportedFound []string
+	foundMap := make(map[string]bool)
+	for _, r := range roots {
+		objects, err := client.List(strings.TrimSuffix(r, "/") + "/")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, o := range objects {
+			if !isVideo(o) {
+				continue
+			}
+			exportedFound = append(exportedFound, o)
+			foundMap[o] = true
+		}
+	}
+
+	var exportedMissing []string
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	for _, f := range toCheck {
+		if !isVideo(f) || strings.HasPrefix(f, prefix) && !foundMap[f] {
+			exportedMissing = append(exportedMissing, f)
+		}
+	}
+
+	return exportedMissing, exportedFound, nil
+}
+
+// writeExportFile writes a sidecar file next to an export, in the bucket for
+// s3:// exports
+func (t *Tablo) writeExportFile(file string, data []byte) error {
+	if !s3store.IsURL(file) {
+		err := os.WriteFile(file, data, userRWX)
+		if err != nil {
+			return fmt.Errorf("os.WriteFile error in writeExportFile: %v", err)
+		}
+		return nil
+	}
+
+	client, err := t.s3Client()
+	if err != nil {
+		return err
+	}
+
+	return client.Put(file, data)
+}
+
+func (t *Tablo) exportFileExists(file string) (bool, error) {
+	if !s3store.IsURL(file) {
+		_, err := os.Stat(file)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("os.Stat error in exportFileExists: %v", err)
+		}
+		return true, nil
+	}
+
+	client, err := t.s3Client()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = client.Size(file)
+	if errors.Is(err, s3store.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,117 @@
+package tablo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/davidw1457/tablo-manager/tabloapi"
+)
+
+// StaticConfigFile is read from the database directory, if it exists, for
+// Tablos to use instead of discovery. Each line is a Tablo definition as taken
+// by ParseTabloDefinition. Blank lines and lines starting with # are ignored.
+const StaticConfigFile = "tablos.conf"
+
+// ParseTabloDefinition reads a Tablo given as ip[,serverID[,name]]
+func ParseTabloDefinition(definition string) (tabloapi.TabloDetails, error) {
+	fields := strings.SplitN(definition, ",", 3)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	tablo := tabloapi.TabloDetails{PrivateIP: fields[0]}
+	if net.ParseIP(tablo.PrivateIP) == nil {
+		return tablo, fmt.Errorf("invalid tablo ip address %q", tablo.PrivateIP)
+	}
+
+	if len(fields) > 1 {
+		tablo.ServerID = fields[1]
+	}
+	if len(fields) > 2 {
+		tablo.Name = fields[2]
+	}
+
+	return tablo, nil
+}
+
+// LoadTabloDefinitions reads StaticConfigFile from databaseDir. A missing file
+// is not an error.
+func LoadTabloDefinitions(databaseDir string) ([]tabloapi.TabloDetails, error) {
+	f, err := os.Open(databaseDir + string(os.PathSeparator) + StaticConfigFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("os.Open error in LoadTabloDefinitions: %v", err)
+	}
+	defer f.Close()
+
+	var tablos []tabloapi.TabloDetails
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tablo, err := ParseTabloDefinition(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", StaticConfigFile, lineNumber, err)
+		}
+		tablos = append(tablos, tablo)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("bufio.Scanner error in LoadTabloDefinitions: %v", err)
+	}
+
+	return tablos, nil
+}
+
+// resolveStatic contacts each defined Tablo directly to fill in its server ID
+// and name. A Tablo that cannot be reached is still used if its server ID was
+// given, so its existing cache can be opened.
+func resolveStatic(definitions []tabloapi.TabloDetails, staticLog *log.Logger) ([]tabloapi.TabloDetails, error) {
+	var tablos []tabloapi.TabloDetails
+	var errs []error
+	seen := make(map[string]bool)
+
+	for _, d := range definitions {
+		staticLog.Printf("reading server info from %s\n", d.PrivateIP)
+		info, err := getServerInfo(d.PrivateIP, staticLog)
+		switch {
+		case err != nil && d.ServerID == "":
+			errs = append(errs, fmt.Errorf("unable to read server info from %s: %v", d.PrivateIP, err))
+			continue
+		case err != nil:
+			staticLog.Printf("unable to read server info from %s (%v). using configured server id %s\n", d.PrivateIP, err, d.ServerID)
+		case d.ServerID != "" && d.ServerID != info.ServerID:
+			errs = append(errs, fmt.Errorf("tablo at %s is %s, not %s", d.PrivateIP, info.ServerID, d.ServerID))
+			continue
+		default:
+			d.ServerID = info.ServerID
+			if d.Name == "" {
+				d.Name = info.Name
+			}
+		}
+
+		if d.Name == "" {
+			d.Name = d.ServerID
+		}
+
+		if seen[d.ServerID] {
+			staticLog.Printf("%s is defined more than once. using the first definition\n", d.ServerID)
+			continue
+		}
+		seen[d.ServerID] = true
+
+		tablos = append(tablos, d)
+	}
+
+	return tablos, errors.Join(errs...)
+}
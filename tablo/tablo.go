@@ -1,33 +1,24 @@
 package tablo
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/davidw1457/tablo-manager/stringmanip"
+	"github.com/davidw1457/tablo-manager/s3store"
 	"github.com/davidw1457/tablo-manager/tabloapi"
 	"github.com/davidw1457/tablo-manager/tablodb"
 )
 
-const tabloWebUri = "https://api.tablotv.com/assocserver/getipinfo/"
 const userRWX = 0700 // unix-style octal permission
-var showTypeSubpath = map[string]string{
-	"series": "/series/episodes",
-	"movies": "/movies/airings",
-	"sports": "/sports/events",
-}
 
 type Tablo struct {
-	ipAddress             string
 	serverID              string
 	name                  string
 	database              tablodb.TabloDB
@@ -37,6 +28,18 @@ type Tablo struct {
 	queue                 []tablodb.QueueRecord
 	log                   *log.Logger
 	defaultExportPath     string
+	exportTemplates       map[string]string
+	exports               *exporter
+	s3                    *s3store.Client
+	s3Lock                sync.Mutex
+	rediscoverLock        sync.Mutex
+	lastRediscovery       time.Time
+	discoveryMethod       string
+	lastSeen              time.Time
+	offline               bool
+	api                   API
+	ctx                   context.Context
+	cancel                context.CancelFunc
 }
 
 type exportAiring struct {
@@ -45,132 +48,171 @@ type exportAiring struct {
 	exportFile string
 }
 
-func New(databaseDir string) ([]*Tablo, error) {
-	logFile, err := os.OpenFile(databaseDir+string(os.PathSeparator)+"main.log", os.O_WRONLY|os.O_APPEND|os.O_CREATE, userRWX)
+// New opens or creates a cache for every Tablo found. Tablos listed in
+// staticTablos or the database directory's tablos.conf are contacted directly
+// and discovery is skipped. Otherwise discoveryMethod is used to find them.
+func New(databaseDir string, discoveryMethod string, staticTablos []tabloapi.TabloDetails) ([]*Tablo, error) {
+	logFile, err := openMainLog(databaseDir)
 	if err != nil {
-		return nil, fmt.Errorf("os.OpenFile error in New: %v", err)
+		return nil, err
 	}
 	tabloFactoryLog := log.New(io.MultiWriter(logFile, os.Stdout), "tablo: ", log.LstdFlags)
 
 	var tablos []*Tablo
+	var errMessage strings.Builder
 
-	var localDBs = make(map[string]string)
-
-	tabloFactoryLog.Println("checking for existing caches")
-	files, err := os.ReadDir(databaseDir)
+	tabloInfo, err := findTablos(databaseDir, discoveryMethod, staticTablos, tabloFactoryLog)
 	if err != nil {
 		tabloFactoryLog.Println(err.Error())
-		return nil, err
+		if len(tabloInfo) == 0 {
+			return nil, err
+		}
+		errMessage.WriteString(err.Error())
 	}
 
-	for _, v := range files {
-		fileName := v.Name()
-		if stringmanip.Substring(fileName, -6, 6) == ".cache" {
-			localDBs[stringmanip.Substring(fileName, 0, len(fileName)-6)] = fileName
+	tabloFactoryLog.Println("creating Tablo object for each tablo retrieved")
+
+	for _, tabloData := range tabloInfo {
+		tablo, err := openTablo(tabloData, databaseDir, discoveryMethod, logFile, tabloFactoryLog)
+		if err != nil {
+			tabloFactoryLog.Println(err.Error())
+			errMessage.WriteString(tabloData.ServerID + ": " + err.Error())
+		} else {
+			tablos = append(tablos, tablo)
 		}
 	}
 
-	tabloFactoryLog.Println("getting tablo info from web")
-	tabloWebResponse, err := get(tabloWebUri)
-	if err != nil {
-		tabloFactoryLog.Println(err.Error())
-		return nil, err
+	if errMessage.String() != "" {
+		// errors logged during tabloInfo iteration don't need to be logged now
+		return tablos, errors.New(errMessage.String())
 	}
 
-	tabloFactoryLog.Println("unmarshalling tablo info")
+	tabloFactoryLog.Printf("%d tablos created\n", len(tablos))
+	return tablos, nil
+}
 
-	var tabloInfo tabloapi.WebAPIResp
-	err = json.Unmarshal(tabloWebResponse, &tabloInfo)
+// findTablos returns the Tablos listed in staticTablos and tablos.conf or, if
+// there are none, the Tablos found by discovery
+func findTablos(databaseDir string, discoveryMethod string, staticTablos []tabloapi.TabloDetails, findLog *log.Logger) ([]tabloapi.TabloDetails, error) {
+	definitions, err := LoadTabloDefinitions(databaseDir)
 	if err != nil {
-		tabloFactoryLog.Println(err.Error())
 		return nil, err
 	}
+	definitions = append(definitions, staticTablos...)
 
-	tabloFactoryLog.Println("creating Tablo object for each tablo retrieved")
+	if len(definitions) > 0 {
+		findLog.Printf("using %d configured tablos instead of discovery\n", len(definitions))
+		return resolveStatic(definitions, findLog)
+	}
 
-	var errMessage strings.Builder
+	findLog.Println("getting tablo info")
+	return discover(discoveryMethod, findLog)
+}
 
-	for _, tabloData := range tabloInfo.Cpes {
-		var tablo *Tablo
-		if localDBs[tabloData.ServerID] != "" {
-			tablo = &Tablo{
-				ipAddress: tabloData.PrivateIP,
-				name:      tabloData.Name,
-				serverID:  tabloData.ServerID,
-				log:       log.New(io.MultiWriter(logFile, os.Stdout), "tablo "+tabloData.ServerID+": ", log.LstdFlags),
+// openTablo opens the existing cache for a Tablo, or creates a new one if there
+// is no cache or the existing cache cannot be opened
+func openTablo(tabloData tabloapi.TabloDetails, databaseDir string, discoveryMethod string, logFile io.Writer, tabloFactoryLog *log.Logger) (*Tablo, error) {
+	cacheFile := databaseDir + string(os.PathSeparator) + tabloData.ServerID + ".cache"
+	_, err := os.Stat(cacheFile)
+	if err == nil {
+		tablo := &Tablo{
+			name:            tabloData.Name,
+			serverID:        tabloData.ServerID,
+			log:             log.New(io.MultiWriter(logFile, os.Stdout), "tablo "+tabloData.ServerID+": ", log.LstdFlags),
+			discoveryMethod: discoveryMethod,
+			lastSeen:        time.Now(),
+		}
+		tablo.database, err = tablodb.Open(tabloData.ServerID, tabloData.PrivateIP, tabloData.Name, databaseDir)
+		if err != nil {
+			tabloFactoryLog.Println(err)
+			err = os.Remove(cacheFile)
+			if err != nil {
+				return nil, err
 			}
-			tablo.database, err = tablodb.Open(tabloData.ServerID, tabloData.PrivateIP, tabloData.Name, databaseDir)
+		} else {
+			tablo.guideLastUpdated, tablo.scheduledLastUpdated, tablo.recordingsLastUpdated, err = tablo.database.GetLastUpdated()
 			if err != nil {
-				tabloFactoryLog.Println(err)
-				err = os.Remove(databaseDir + string(os.PathSeparator) + localDBs[tabloData.ServerID])
-				if err != nil {
-					tabloFactoryLog.Println(err)
-					return nil, err
-				}
-
-				tablo = nil
-			} else {
-				tablo.guideLastUpdated, tablo.scheduledLastUpdated, tablo.recordingsLastUpdated, err = tablo.database.GetLastUpdated()
-				if err != nil {
-					tabloFactoryLog.Println(err)
-					return nil, err
-				}
-				tablo.defaultExportPath, err = tablo.database.GetDefaultExportPath()
-				if err != nil {
-					tabloFactoryLog.Println(err)
-					return nil, err
-				}
-
-				tablos = append(tablos, tablo)
+				return nil, err
 			}
-
-		}
-
-		if tablo == nil {
-			tablo = &Tablo{
-				ipAddress:             tabloData.PrivateIP,
-				name:                  tabloData.Name,
-				serverID:              tabloData.ServerID,
-				guideLastUpdated:      time.Unix(0, 0),
-				scheduledLastUpdated:  time.Unix(0, 0),
-				recordingsLastUpdated: time.Unix(0, 0),
-				log:                   log.New(io.MultiWriter(logFile, os.Stdout), "tablo "+tabloData.ServerID+": ", log.LstdFlags),
+			tablo.defaultExportPath, err = tablo.database.GetDefaultExportPath()
+			if err != nil {
+				return nil, err
 			}
-			tablo.database, err = tablodb.New(tablo.ipAddress, tablo.name, tablo.serverID, databaseDir)
+			tablo.exportTemplates, err = tablo.database.GetExportTemplates()
 			if err != nil {
-				tabloFactoryLog.Println(err.Error())
-				errMessage.WriteString(tabloData.ServerID + ": " + err.Error())
-			} else {
-				tablos = append(tablos, tablo)
+				return nil, err
+			}
+			workers, bytesPerSecond, err := tablo.database.GetExportLimits()
+			if err != nil {
+				return nil, err
 			}
+			tablo.exports = newExporter(workers, bytesPerSecond, tablo.runExport)
+			requestTimeout, err := tablo.database.GetRequestTimeout()
+			if err != nil {
+				return nil, err
+			}
+			batchWorkers, err := tablo.database.GetBatchWorkers()
+			if err != nil {
+				return nil, err
+			}
+			tablo.api = tablo.newAPI(tabloData.PrivateIP, requestTimeout, batchWorkers)
+			tablo.ctx, tablo.cancel = context.WithCancel(context.Background())
+
+			return tablo, nil
 		}
 	}
 
-	if errMessage.String() != "" {
-		// errors logged during tabloInfo.Cpes iteration don't need to be logged now
-		return tablos, errors.New(errMessage.String())
+	tablo := &Tablo{
+		name:                  tabloData.Name,
+		serverID:              tabloData.ServerID,
+		guideLastUpdated:      time.Unix(0, 0),
+		scheduledLastUpdated:  time.Unix(0, 0),
+		recordingsLastUpdated: time.Unix(0, 0),
+		log:                   log.New(io.MultiWriter(logFile, os.Stdout), "tablo "+tabloData.ServerID+": ", log.LstdFlags),
+		discoveryMethod:       discoveryMethod,
+		lastSeen:              time.Now(),
+	}
+	tablo.exports = newExporter(1, 0, tablo.runExport)
+	tablo.api = tablo.newAPI(tabloData.PrivateIP, 0, 0)
+	tablo.ctx, tablo.cancel = context.WithCancel(context.Background())
+	tablo.database, err = tablodb.New(tabloData.PrivateIP, tablo.name, tablo.serverID, databaseDir)
+	if err != nil {
+		return nil, err
 	}
 
-	tabloFactoryLog.Printf("%d tablos created\n", len(tablos))
-	return tablos, nil
+	return tablo, nil
 }
 
 func (t *Tablo) String() string {
-	return fmt.Sprintf("Name: %s, ID: %s, IP: %s", t.name, t.serverID, t.ipAddress)
+	return fmt.Sprintf("Name: %s, ID: %s, IP: %s", t.name, t.serverID, t.address())
 }
 
+// Close cancels any request still waiting on the Tablo, waits for the running
+// exports to stop and closes the cache. Interrupted exports stay in the queue.
 func (t *Tablo) Close() {
+	t.log.Println("stopping running exports")
+	t.cancel()
+	t.exports.wait()
+
 	t.log.Println("closing tablo database")
 	defer t.database.Close()
 }
 
 func (t *Tablo) NeedUpdate() bool {
+	if t.offline {
+		return false
+	}
+
 	now := time.Now()
 
 	return now.After(t.scheduledLastUpdated.Add(6*time.Hour)) || now.After(t.guideLastUpdated.Add(24*time.Hour)) || now.After(t.recordingsLastUpdated.Add(6*time.Hour))
 }
 
 func (t *Tablo) EnqueueUpdate() error {
+	if t.offline {
+		return errOffline
+	}
+
 	t.log.Println("enqueueing update tasks")
 	now := time.Now()
 
@@ -209,6 +251,11 @@ func (t *Tablo) HasQueueItems() bool {
 }
 
 func (t *Tablo) LoadQueue() error {
+	if t.offline {
+		// the queue can't be worked while offline, so leave it in the cache
+		return nil
+	}
+
 	t.log.Println("loading queue from cache")
 	queue, err := t.database.GetQueue()
 	if err != nil {
@@ -221,6 +268,10 @@ func (t *Tablo) LoadQueue() error {
 }
 
 func (t *Tablo) ProcessQueue() error {
+	if t.offline {
+		return errOffline
+	}
+
 	t.log.Println("processing all queue records")
 
 	for _, queueRecord := range t.queue {
@@ -228,6 +279,7 @@ func (t *Tablo) ProcessQueue() error {
 		case "UPDATEGUIDE":
 			t.log.Println("updating guide")
 			err := t.updateGuide()
+			t.recordHistory(queueRecord, err)
 			if err != nil {
 				t.log.Println(err)
 				return err
@@ -235,6 +287,7 @@ func (t *Tablo) ProcessQueue() error {
 		case "UPDATESCHEDULED":
 			t.log.Println("updating schedule")
 			err := t.updateScheduled()
+			t.recordHistory(queueRecord, err)
 			if err != nil {
 				t.log.Println(err)
 				return err
@@ -242,19 +295,21 @@ func (t *Tablo) ProcessQueue() error {
 		case "UPDATERECORDINGS":
 			t.log.Println("updating recordings")
 			err := t.updateRecordings()
+			t.recordHistory(queueRecord, err)
 			if err != nil {
 				t.log.Println(err)
 				return err
 			}
 		case "EXPORT":
-			t.log.Printf("exporting %s\n", queueRecord.Details)
-			err := t.exportRecording(queueRecord.Details, queueRecord.ExportPath)
-			if err != nil {
-				t.log.Println(err)
-				return err
+			// exports run in the background and delete their own queue record
+			// once they succeed
+			if t.exports.add(queueRecord) {
+				t.log.Printf("export of %s queued to run in the background\n", queueRecord.Details)
 			}
+			continue
 		default:
 			t.log.Printf("invalid action: %s\n", queueRecord.Action)
+			t.recordHistory(queueRecord, fmt.Errorf("invalid action: %s", queueRecord.Action))
 		}
 		t.log.Printf("deleting queue record %d %s %s\n", queueRecord.QueueID, queueRecord.Action, queueRecord.Details)
 		err := t.database.DeleteQueueRecord(queueRecord.QueueID)
@@ -270,7 +325,7 @@ func (t *Tablo) ProcessQueue() error {
 		}
 	}
 	t.queue = nil
-	t.log.Println("all queue records processed")
+	t.log.Printf("all queue records processed. %d exports pending or running\n", t.exports.running())
 	return nil
 }
 
@@ -284,21 +339,21 @@ func (t *Tablo) updateGuide() error {
 			t.log.Println(err)
 			return err
 		}
-		err = t.updateChannels("/guide/channels")
+		err = t.updateChannels(t.api.GuideChannels)
 		if err != nil {
 			t.log.Println(err)
 			return err
 		}
 
 		t.log.Println("updating shows")
-		err = t.updateShows("/guide/shows")
+		err = t.updateShows(t.api.GuideShows)
 		if err != nil {
 			t.log.Println(err)
 			return err
 		}
 
 		t.log.Println("updating airings")
-		err = t.updateAirings("/guide/airings")
+		err = t.updateAirings("")
 		if err != nil {
 			t.log.Println(err)
 			return err
@@ -364,13 +419,13 @@ func (t *Tablo) updateScheduled() error {
 			t.log.Println(err)
 			return err
 		}
-		err = t.updateChannels("/guide/channels")
+		err = t.updateChannels(t.api.GuideChannels)
 		if err != nil {
 			t.log.Println(err)
 			return err
 		}
 		t.log.Println("updating shows")
-		err = t.updateShows("/guide/shows")
+		err = t.updateShows(t.api.GuideShows)
 		if err != nil {
 			t.log.Println(err)
 			return err
@@ -382,20 +437,20 @@ func (t *Tablo) updateScheduled() error {
 			return err
 		}
 		t.log.Println("updating scheduled airings")
-		err = t.updateAirings("/guide/airings?state=scheduled")
+		err = t.updateAirings("scheduled")
 		if err != nil {
 			t.log.Println(err)
 
-			if err.Error() != "no airings returned" {
+			if !errors.Is(err, ErrEmptyResult) {
 				return err
 			}
 		}
 		t.log.Println("updating conflicted airings")
-		err = t.updateAirings("/guide/airings?state=conflicted")
+		err = t.updateAirings("conflicted")
 		if err != nil {
 			t.log.Println(err)
 
-			if err.Error() != "no airings returned" {
+			if !errors.Is(err, ErrEmptyResult) {
 				return err
 			}
 		}
@@ -447,21 +502,21 @@ func (t *Tablo) updateScheduled() error {
 
 func (t *Tablo) updateRecordings() error {
 	t.log.Println("updating recording channels")
-	err := t.updateChannels("/recordings/channels")
+	err := t.updateChannels(t.api.RecordingChannels)
 	if err != nil {
 		t.log.Println(err)
 
-		if err.Error() != "no channels returned" {
+		if !errors.Is(err, ErrEmptyResult) {
 			return err
 		}
 	}
 
 	t.log.Println("updating recording shows")
-	err = t.updateShows("/recordings/shows")
+	err = t.updateShows(t.api.RecordingShows)
 	if err != nil {
 		t.log.Println(err)
 
-		if err.Error() != "no shows returned" {
+		if !errors.Is(err, ErrEmptyResult) {
 			return err
 		}
 	}
@@ -471,7 +526,7 @@ func (t *Tablo) updateRecordings() error {
 	if err != nil {
 		t.log.Println(err)
 
-		if err.Error() != "no recording airings returned" {
+		if !errors.Is(err, ErrEmptyResult) {
 			return err
 		}
 	}
@@ -483,55 +538,42 @@ func (t *Tablo) updateRecordings() error {
 		return err
 	}
 
+	t.log.Println("queueing exports for finished recordings")
+	err = t.enqueueExports()
+	if err != nil {
+		t.log.Println(err)
+		return err
+	}
+
 	t.log.Println("recordings updated")
 	return nil
 }
 
-func (t *Tablo) updateChannels(suffix string) error {
+// updateChannels lists the channels with list and adds their details to the
+// cache
+func (t *Tablo) updateChannels(list func(context.Context) ([]string, error)) error {
 	t.log.Println("updating channels")
 
-	uri := "http://" + t.ipAddress + ":8885"
-	response, err := get(uri + suffix)
-	if err != nil {
-		t.log.Println(err)
-		return err
-	}
-
-	var channels []string
-	err = json.Unmarshal(response, &channels)
+	channels, err := list(t.ctx)
 	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	if len(channels) > 0 {
-		t.log.Printf("getting details for %d channels\n", len(channels))
-		response, err = batch(uri, channels)
-		if err != nil {
-			t.log.Println(err)
-			return err
-		}
-	} else {
-		err = fmt.Errorf("no channels returned")
+	if len(channels) == 0 {
+		err = fmt.Errorf("no channels returned: %w", ErrEmptyResult)
 		t.log.Println(err)
 		return err
 	}
 
-	var channelDetails map[string]tabloapi.Channel
-	err = json.Unmarshal(response, &channelDetails)
+	t.log.Printf("getting details for %d channels\n", len(channels))
+	count, err := batchUpsert(t, "channels", channels, t.database.UpsertChannels)
 	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	if len(channelDetails) > 0 {
-		t.log.Printf("adding %d channels to database\n", len(channelDetails))
-		err = t.database.UpsertChannels(channelDetails)
-		if err != nil {
-			t.log.Println(err)
-			return err
-		}
-	} else {
+	if count == 0 {
 		err = fmt.Errorf("no channel details returned")
 		t.log.Println(err)
 		return err
@@ -541,51 +583,30 @@ func (t *Tablo) updateChannels(suffix string) error {
 	return nil
 }
 
-func (t *Tablo) updateShows(suffix string) error {
+// updateShows lists the shows with list and adds their details to the cache
+func (t *Tablo) updateShows(list func(context.Context) ([]string, error)) error {
 	t.log.Println("updating shows")
 
-	uri := "http://" + t.ipAddress + ":8885"
-	response, err := get(uri + suffix)
+	shows, err := list(t.ctx)
 	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	var shows []string
-	err = json.Unmarshal(response, &shows)
-	if err != nil {
-		t.log.Println(err)
-		return err
-	}
-
-	if len(shows) > 0 {
-		t.log.Printf("getting details for %d shows\n", len(shows))
-		response, err = batch(uri, shows)
-		if err != nil {
-			t.log.Println(err)
-			return err
-		}
-	} else {
-		err = fmt.Errorf("no shows returned")
+	if len(shows) == 0 {
+		err = fmt.Errorf("no shows returned: %w", ErrEmptyResult)
 		t.log.Println(err)
 		return err
 	}
 
-	var showDetails map[string]tabloapi.Show
-	err = json.Unmarshal(response, &showDetails)
+	t.log.Printf("getting details for %d shows\n", len(shows))
+	count, err := batchUpsert(t, "shows", shows, t.database.UpsertShows)
 	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	if len(showDetails) > 0 {
-		t.log.Printf("adding %d shows to database\n", len(showDetails))
-		err = t.database.UpsertShows(showDetails)
-		if err != nil {
-			t.log.Println(err)
-			return err
-		}
-	} else {
+	if count == 0 {
 		err = fmt.Errorf("no show details returned")
 		t.log.Println(err)
 		return err
@@ -595,51 +616,31 @@ func (t *Tablo) updateShows(suffix string) error {
 	return nil
 }
 
-func (t *Tablo) updateAirings(suffix string) error {
+// updateAirings adds the guide airings in state, or all of them if state is
+// "", to the cache
+func (t *Tablo) updateAirings(state string) error {
 	t.log.Println("updating airings")
 
-	uri := "http://" + t.ipAddress + ":8885"
-	response, err := get(uri + suffix)
-	if err != nil {
-		t.log.Println(err)
-		return err
-	}
-
-	var airings []string
-	err = json.Unmarshal(response, &airings)
+	airings, err := t.api.GuideAirings(t.ctx, state)
 	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	if len(airings) > 0 {
-		t.log.Printf("getting details for %d airings\n", len(airings))
-		response, err = batch(uri, airings)
-		if err != nil {
-			t.log.Println(err)
-			return err
-		}
-	} else {
-		err = fmt.Errorf("no airings returned")
+	if len(airings) == 0 {
+		err = fmt.Errorf("no airings returned: %w", ErrEmptyResult)
 		t.log.Println(err)
 		return err
 	}
 
-	var airingDetails map[string]tabloapi.Airing
-	err = json.Unmarshal(response, &airingDetails)
+	t.log.Printf("getting details for %d airings\n", len(airings))
+	count, err := batchUpsert(t, "airings", airings, t.database.UpsertAirings)
 	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	if len(airingDetails) > 0 {
-		t.log.Printf("adding %d airings to database\n", len(airingDetails))
-		err = t.database.UpsertAirings(airingDetails)
-		if err != nil {
-			t.log.Println(err)
-			return err
-		}
-	} else {
+	if count == 0 {
 		err = fmt.Errorf("no airing details returned")
 		t.log.Println(err)
 		return err
@@ -649,59 +650,46 @@ func (t *Tablo) updateAirings(suffix string) error {
 	return nil
 }
 
-func (t *Tablo) exportRecording(toExport string, exportPath string) error {
-	// TODO: Write up export
-	t.log.Printf("%s : %s\n", toExport, exportPath)
-	t.log.Println("not yet implemented")
-	return nil
-}
-
 func (t *Tablo) updateRecordingAirings() error {
 	t.log.Println("updating recording airings")
 
-	uri := "http://" + t.ipAddress + ":8885"
-	response, err := get(uri + "/recordings/airings")
+	recordings, err := t.api.RecordingAirings(t.ctx)
 	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	var recordings []string
-	err = json.Unmarshal(response, &recordings)
-	if err != nil {
+	if len(recordings) == 0 {
+		err = fmt.Errorf("no recording airings returned: %w", ErrEmptyResult)
 		t.log.Println(err)
 		return err
 	}
 
-	if len(recordings) > 0 {
-		t.log.Printf("getting details for %d recording airings\n", len(recordings))
-		response, err = batch(uri, recordings)
-		if err != nil {
-			t.log.Println(err)
-			return err
+	t.log.Printf("getting details for %d recording airings\n", len(recordings))
+	// recordings missing from the Tablo can only be purged once every chunk
+	// has been written
+	var recordingIDs []int
+	count, err := batchUpsert(t, "recording airings", recordings, func(chunk map[string]tabloapi.Recording) error {
+		for _, r := range chunk {
+			if r.ObjectID != 0 {
+				recordingIDs = append(recordingIDs, r.ObjectID)
+			}
 		}
-	} else {
-		err = fmt.Errorf("no recording airings returned")
+		return t.database.UpsertRecordings(chunk)
+	})
+	if err != nil {
 		t.log.Println(err)
 		return err
 	}
 
-	var recordingDetails map[string]tabloapi.Recording
-	err = json.Unmarshal(response, &recordingDetails)
-	if err != nil {
+	if count == 0 {
+		err = fmt.Errorf("no recording airing details returned")
 		t.log.Println(err)
 		return err
 	}
 
-	if len(recordingDetails) > 0 {
-		t.log.Printf("adding %d recording airings to database\n", len(recordingDetails))
-		err = t.database.UpsertRecordings(recordingDetails)
-		if err != nil {
-			t.log.Println(err)
-			return err
-		}
-	} else {
-		err = fmt.Errorf("no recording airing details returned")
+	err = t.database.DeleteRemovedRecordings(recordingIDs)
+	if err != nil {
 		t.log.Println(err)
 		return err
 	}
@@ -719,16 +707,7 @@ func (t *Tablo) updateConflicts() error {
 }
 
 func (t *Tablo) updateSpace() error {
-	uri := "http://" + t.ipAddress + ":8885"
-
-	response, err := get(uri + "/server/harddrives")
-	if err != nil {
-		t.log.Println(err)
-		return err
-	}
-
-	var drives []tabloapi.Drive
-	err = json.Unmarshal(response, &drives)
+	drives, err := t.api.HardDrives(t.ctx)
 	if err != nil {
 		t.log.Println(err)
 		return err
@@ -771,7 +750,12 @@ func (t *Tablo) updateExported(alternatePath string) (int, error) {
 		return 0, err
 	}
 
-	exportedMissing, exportedFound, err := checkExported(currentExported, path)
+	var exportedMissing, exportedFound []string
+	if s3store.IsURL(path) {
+		exportedMissing, exportedFound, err = t.checkExportedS3(currentExported, path, getExportRoots(path, t.exportTemplates))
+	} else {
+		exportedMissing, exportedFound, err = checkExported(currentExported, getExportRoots(path, t.exportTemplates))
+	}
 	if err != nil {
 		t.log.Println(err)
 		return 0, err
@@ -794,10 +778,25 @@ func (t *Tablo) updateExported(alternatePath string) (int, error) {
 			return 0, err
 		}
 
+		t.log.Println("getting exports that failed verification")
+		suspect, err := t.database.GetSuspectExported()
+		if err != nil {
+			t.log.Println(err)
+			return 0, err
+		}
+
+		suspectMap := make(map[string]bool)
+		for _, e := range suspect {
+			suspectMap[e] = true
+		}
+
 		t.log.Println("creating map of exported items")
 		exportedFoundMap := make(map[string]bool)
 		for _, e := range exportedFound {
-			exportedFoundMap[e] = true
+			// suspect exports must not suppress recordings
+			if !suspectMap[e] {
+				exportedFoundMap[e] = true
+			}
 		}
 
 		t.log.Println("getting all scheduled airings to match with exported items")
@@ -819,6 +818,22 @@ func (t *Tablo) updateExported(alternatePath string) (int, error) {
 			}
 		}
 
+		t.log.Println("matching scheduled airings to exported shows by identity")
+		var libraryFiles []string
+		for f := range exportedFoundMap {
+			libraryFiles = append(libraryFiles, f)
+		}
+
+		matched, ambiguous := matchLibrary(libraryFiles, scheduled)
+		for _, a := range ambiguous {
+			t.log.Printf("ambiguous match. %s matches airings %v. not unscheduling\n", a.file, a.airingIDs)
+		}
+		t.log.Printf("%d airings matched by identity, %d ambiguous files\n", len(matched), len(ambiguous))
+
+		for airingID, showType := range matched {
+			toUnschedule[airingID] = showType
+		}
+
 		if len(toUnschedule) > 0 {
 			t.log.Println("unscheduling exported airings")
 			unscheduledCount, err = t.unscheduleAirings(toUnschedule)
@@ -840,7 +855,7 @@ func (t *Tablo) getExportFilenames(airings []tablodb.ScheduledAiringRecord) []ex
 		var export exportAiring
 		export.airingID = a.AiringID
 		export.showType = a.ShowType
-		export.exportFile = getExportFilename(a, t.defaultExportPath)
+		export.exportFile = getExportFilename(a, t.defaultExportPath, t.exportTemplates)
 		exportFilenames = append(exportFilenames, export)
 	}
 
@@ -852,28 +867,19 @@ func (t *Tablo) unscheduleAirings(airings map[int]string) (int, error) {
 	unscheduled := 0
 
 	for airingID, showType := range airings {
-		uri := "http://" + t.ipAddress + ":8885"
-		subpath := "/guide" + showTypeSubpath[showType] + "/" + strconv.Itoa(airingID)
-		resp, err := patch(uri+subpath, `{"scheduled": false}`)
-		if err != nil {
-			t.log.Println(err)
-			return unscheduled, err
-		}
-
-		var airing tabloapi.Airing
-		err = json.Unmarshal(resp, &airing)
-		if err != nil {
-			t.log.Println(err)
-			return unscheduled, err
-		}
-
-		if airing.Error.Code == "object_not_found" {
+		airing, err := t.api.Unschedule(t.ctx, showType, airingID)
+		if errors.Is(err, ErrNotFound) {
 			t.log.Printf("%d not found\n", airingID)
 			err = t.database.DeleteAiring(airingID)
 			if err != nil {
 				t.log.Println(err)
 				return unscheduled, err
 			}
+			unscheduled++
+			continue
+		} else if err != nil {
+			t.log.Println(err)
+			return unscheduled, err
 		} else if airing.Schedule.State != "unscheduled" && airing.Schedule.State != "none" {
 			err = fmt.Errorf("unschedule failed for %d", airingID)
 
@@ -892,7 +898,7 @@ func (t *Tablo) unscheduleAirings(airings map[int]string) (int, error) {
 	return unscheduled, nil
 }
 
-func (t *Tablo) autoresolveConflicts() (error) {
+func (t *Tablo) autoresolveConflicts() error {
 	conflicts, err := t.database.GetPrioritizedConflicts()
 	if err != nil {
 		t.log.Println(err)
@@ -940,58 +946,21 @@ func (t *Tablo) autoresolveConflicts() (error) {
 	return nil
 }
 
-func getExportFilename(airing tablodb.ScheduledAiringRecord, path string) string {
-	sep := string(os.PathSeparator)
-
-	switch airing.ShowType {
-	case "series":
-		showTitle := stringmanip.SanitizeFile(airing.ShowTitle)
+func checkExported(toCheck []string, roots []string) ([]string, []string, error) {
+	var exportedMissing []string
 
-		var season string
-		if len(airing.Season) == 1 {
-			season = "0" + stringmanip.SanitizeFile(airing.Season)
-		} else if airing.Season == "" {
-			season = "00"
-		} else {
-			season = stringmanip.SanitizeFile(airing.Season)
-		}
-		episodeTitle := stringmanip.SanitizeFile(airing.EpisodeTitle)
-		episode := fmt.Sprintf("%02d", airing.Episode)
-		if episode == "00" && episodeTitle == "" {
-			airDate := time.Unix(int64(airing.AirDate), 0)
-			episode = airDate.Format("200601021504")
-		}
-		var exportFilename string
-		if episodeTitle == "" {
-			exportFilename = showTitle + " - s" + season + "e" + episode + ".mp4"
-		} else {
-			exportFilename = showTitle + " - s" + season + "e" + episode + " - " + episodeTitle + ".mp4"
-		}
-		return path + sep + "TV" + sep + showTitle + sep + "Season " + season + sep + exportFilename
-	case "movies":
-		showTitle := stringmanip.SanitizeFile(airing.ShowTitle)
-		year := strconv.Itoa(airing.ReleaseYear)
-		return path + sep + "Movies" + sep + showTitle + " - " + year + ".mp4"
-	case "sports":
-		showTitle := stringmanip.SanitizeFile(airing.ShowTitle)
-
-		var season string
-		if airing.Season == "" {
-			season = "00"
-		} else {
-			season = stringmanip.SanitizeFile(airing.Season)
+	for _, f := range toCheck {
+		if !isVideo(f) {
+			// sidecars recorded as exports by earlier versions
+			exportedMissing = append(exportedMissing, f)
+			continue
 		}
-		episodeTitle := stringmanip.SanitizeFile(airing.EpisodeTitle)
-		return path + sep + "Sports" + sep + showTitle + sep + showTitle + " - " + season + " - " + episodeTitle + ".mp4"
-	default:
-		return ""
-	}
-}
 
-func checkExported(toCheck []string, path string) ([]string, []string, error) {
-	var exportedMissing []string
+		if s3store.IsURL(f) {
+			// only a bucket listing can tell whether these still exist
+			continue
+		}
 
-	for _, f := range toCheck {
 		switch _, err := os.Stat(f); {
 		case errors.Is(err, os.ErrNotExist):
 			exportedMissing = append(exportedMissing, f)
@@ -1002,7 +971,17 @@ func checkExported(toCheck []string, path string) ([]string, []string, error) {
 
 	var exportedFound []string
 	sep := string(os.PathSeparator)
-	pathQueue := []string{path + sep + "Movies", path + sep + "Sports", path + sep + "TV"}
+	var pathQueue []string
+	for _, r := range roots {
+		switch _, err := os.Stat(r); {
+		case errors.Is(err, os.ErrNotExist):
+			// nothing has been exported to this folder yet
+			continue
+		case err != nil:
+			return nil, nil, fmt.Errorf("os.Stat error in checkExported: %v", err)
+		}
+		pathQueue = append(pathQueue, r)
+	}
 
 	for len(pathQueue) > 0 {
 		curPath := pathQueue[0]
@@ -1014,7 +993,7 @@ func checkExported(toCheck []string, path string) ([]string, []string, error) {
 		for _, f := range files {
 			if f.IsDir() {
 				pathQueue = append(pathQueue, curPath+sep+f.Name())
-			} else {
+			} else if isVideo(f.Name()) {
 				exportedFound = append(exportedFound, curPath+sep+f.Name())
 			}
 		}
@@ -1028,123 +1007,3 @@ func checkExported(toCheck []string, path string) ([]string, []string, error) {
 
 	return exportedMissing, exportedFound, nil
 }
-
-func batch(uri string, input []string) ([]byte, error) {
-	var output []byte
-	output = append(output, byte('{'))
-
-	for i := 0; i < len(input); i += 50 {
-		j := i + 50
-		if j > len(input) {
-			j = len(input)
-		}
-		data := "[\"" + strings.Join(input[i:j], "\",\"") + "\"]"
-		tempOutput, err := post(uri+"/batch", data)
-		if err != nil {
-			return nil, err
-		}
-
-		output = append(output, tempOutput[1:len(tempOutput)-1]...)
-		if j < len(input) {
-			output = append(output, byte(','))
-		} else {
-			output = append(output, byte('}'))
-		}
-	}
-
-	return output, nil
-}
-
-func patch(uri string, data string) ([]byte, error) {
-	client := &http.Client{}
-
-	req, err := http.NewRequest(http.MethodPatch, uri, bytes.NewBuffer([]byte(data)))
-	if err != nil {
-		return nil, fmt.Errorf("http.NewRequest error in patch: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		if resp != nil {
-			resp.Body.Close()
-		}
-		fmt.Printf("Error connecting to %s. Waiting 30 seconds to retry\n", uri)
-		time.Sleep(30 * time.Second)
-
-		resp, err = client.Do(req)
-		if err != nil {
-			if resp != nil {
-				resp.Body.Close()
-			}
-			fmt.Printf("http.PATCH error: %v\n", err)
-			return nil, err
-		}
-	}
-
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("io.ReadAll error in patch: %v", err)
-	}
-
-	return body, nil
-}
-
-func post(uri string, data string) ([]byte, error) {
-	resp, err := http.Post(uri, "application/json", bytes.NewBuffer([]byte(data)))
-	if err != nil {
-		if resp != nil {
-			resp.Body.Close()
-		}
-		fmt.Printf("Error connecting to %s. Waiting 30 seconds to retry\n", uri)
-		time.Sleep(30 * time.Second)
-		resp, err = http.Post(uri, "application/json", bytes.NewBuffer([]byte(data)))
-		if err != nil {
-			if resp != nil {
-				resp.Body.Close()
-			}
-			fmt.Printf("http.POST error: %v\n", err)
-			return nil, err
-		}
-	}
-
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("io.ReadAll error in post: %v", err)
-	}
-
-	return body, nil
-}
-
-func get(uri string) ([]byte, error) {
-	resp, err := http.Get(uri)
-	if err != nil {
-		if resp != nil {
-			resp.Body.Close()
-		}
-		fmt.Printf("Error connecting to %s. Waiting 30 seconds to retry\n", uri)
-		time.Sleep(30 * time.Second)
-		resp, err = http.Get(uri)
-		if err != nil {
-			if resp != nil {
-				resp.Body.Close()
-			}
-			fmt.Printf("http.GET error: %v\n", err)
-			return nil, err
-		}
-	}
-
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("io.ReadAll error in get: %v", err)
-	}
-
-	return body, nil
-}
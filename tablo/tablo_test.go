@@ -0,0 +1,421 @@
+package tablo
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidw1457/tablo-manager/tabloapi"
+)
+
+// newTestTablo opens a Tablo that talks to fake, with a new cache in a
+// temporary directory. The cache is also returned, opened directly, for
+// checking results and for settings the app has no API for, like show
+// priorities.
+func newTestTablo(t *testing.T, fake *fakeTablo) (*Tablo, *sql.DB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	tablo := openTestTablo(t, fake, dir)
+
+	cache, err := sql.Open("sqlite3", filepath.Join(dir, fake.info.ServerID+".cache")+"?_busy_timeout=30000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+
+	return tablo, cache
+}
+
+// openTestTablo opens a Tablo that talks to fake, with its cache in dir
+func openTestTablo(t *testing.T, fake *fakeTablo, dir string) *Tablo {
+	t.Helper()
+
+	details := tabloapi.TabloDetails{ServerID: fake.info.ServerID, Name: fake.info.Name, PrivateIP: fake.address()}
+	tablo, err := openTablo(details, dir, DiscoverCloud, io.Discard, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tablo.Close)
+
+	return tablo
+}
+
+// newGuideTablo returns a fake Tablo with three series airing at the same
+// time on a two tuner Tablo: two scheduled and one in conflict. The first
+// series also has a later airing that is not scheduled.
+func newGuideTablo(t *testing.T) (*fakeTablo, time.Time) {
+	t.Helper()
+
+	airDate := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+
+	fake := newFakeTablo(t)
+	fake.addChannel("guide", 100, "WAAA")
+	fake.addSeries("guide", 200, "First Show", 0)
+	fake.addSeries("guide", 201, "Second Show", 0)
+	fake.addSeries("guide", 202, "Third Show", 0)
+	fake.addEpisode(300, 200, 100, airDate, "scheduled")
+	fake.addEpisode(301, 201, 100, airDate, "scheduled")
+	fake.addEpisode(302, 202, 100, airDate, "conflict")
+	fake.addEpisode(303, 200, 100, airDate.Add(time.Hour), "none")
+	fake.setDrives(tabloapi.Drive{Size: 1000, Free: 400}, tabloapi.Drive{Size: 500, Free: 100})
+
+	return fake, airDate
+}
+
+func queryInt(t *testing.T, cache *sql.DB, query string, args ...any) int {
+	t.Helper()
+
+	var value int
+	err := cache.QueryRow(query, args...).Scan(&value)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return value
+}
+
+func airingState(t *testing.T, cache *sql.DB, airingID int) string {
+	t.Helper()
+
+	var state string
+	err := cache.QueryRow("SELECT scheduled FROM airing WHERE airingID = ?", airingID).Scan(&state)
+	if err != nil {
+		t.Fatalf("airing %d: %v", airingID, err)
+	}
+	return state
+}
+
+func setPriorities(t *testing.T, cache *sql.DB, priorities map[int]int) {
+	t.Helper()
+
+	for showID, priority := range priorities {
+		_, err := cache.Exec("INSERT INTO showPriority (showID, priority) VALUES (?, ?)", showID, priority)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateGuide(t *testing.T) {
+	fake, _ := newGuideTablo(t)
+	tablo, cache := newTestTablo(t, fake)
+
+	err := tablo.updateGuide()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{
+		"SELECT count(*) FROM channel":                              1,
+		"SELECT count(*) FROM show":                                 3,
+		"SELECT count(*) FROM airing":                               4,
+		"SELECT count(*) FROM episode":                              4,
+		"SELECT count(*) FROM airing WHERE scheduled = 'scheduled'": 2,
+		"SELECT count(*) FROM scheduleConflicts":                    3,
+		"SELECT totalSize FROM systemInfo":                          1500,
+		"SELECT freeSize FROM systemInfo":                           500,
+	}
+	for query, want := range counts {
+		if got := queryInt(t, cache, query); got != want {
+			t.Errorf("%s = %d, want %d", query, got, want)
+		}
+	}
+
+	// conflicts are only resolved for shows with a priority
+	if patches := fake.patched(); len(patches) != 0 {
+		t.Errorf("PATCH requests = %v, want none", patches)
+	}
+
+	guideLastUpdated, scheduledLastUpdated, _, err := tablo.database.GetLastUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guideLastUpdated.Unix() != tablo.guideLastUpdated.Unix() || scheduledLastUpdated.Unix() != tablo.scheduledLastUpdated.Unix() {
+		t.Errorf("cache last updated %v and %v, want %v and %v", guideLastUpdated, scheduledLastUpdated, tablo.guideLastUpdated, tablo.scheduledLastUpdated)
+	}
+	if time.Since(tablo.guideLastUpdated) > time.Minute {
+		t.Errorf("guideLastUpdated = %v, want now", tablo.guideLastUpdated)
+	}
+}
+
+func TestUpdateScheduled(t *testing.T) {
+	fake, _ := newGuideTablo(t)
+	tablo, cache := newTestTablo(t, fake)
+
+	err := tablo.updateGuide()
+	if err != nil {
+		t.Fatal(err)
+	}
+	guideLastUpdated := tablo.guideLastUpdated
+
+	fake.setState(episodePath("guide", 300), "none")
+	fake.setState(episodePath("guide", 303), "scheduled")
+
+	err = tablo.updateScheduled()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]string{300: "none", 301: "scheduled", 302: "conflict", 303: "scheduled"}
+	for airingID, state := range want {
+		if got := airingState(t, cache, airingID); got != state {
+			t.Errorf("airing %d is %s, want %s", airingID, got, state)
+		}
+	}
+
+	if !tablo.guideLastUpdated.Equal(guideLastUpdated) {
+		t.Errorf("guideLastUpdated changed to %v", tablo.guideLastUpdated)
+	}
+	if !tablo.scheduledLastUpdated.After(guideLastUpdated) {
+		t.Errorf("scheduledLastUpdated = %v, want after %v", tablo.scheduledLastUpdated, guideLastUpdated)
+	}
+}
+
+func TestUpdateRecordings(t *testing.T) {
+	airDate := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+
+	// recorded shows point at their guide show, so the guide is cached first
+	fake, _ := newGuideTablo(t)
+	fake.addChannel("recordings", 100, "WAAA")
+	fake.addSeries("recordings", 400, "First Show", 200)
+	// more than one chunk of recordings, so the cache is written several times
+	recordings := upsertChunkSize + 10
+	for i := 0; i < recordings; i++ {
+		fake.addRecording(500+i, 400, 100, airDate.Add(-time.Duration(i)*time.Hour))
+	}
+
+	tablo, cache := newTestTablo(t, fake)
+
+	err := tablo.updateGuide()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tablo.updateRecordings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := queryInt(t, cache, "SELECT count(*) FROM recording"); got != recordings {
+		t.Errorf("%d recordings cached, want %d", got, recordings)
+	}
+	if got := queryInt(t, cache, "SELECT parentShowID FROM show WHERE showID = -400"); got != 200 {
+		t.Errorf("recorded show parent = %d, want 200", got)
+	}
+	if time.Since(tablo.recordingsLastUpdated) > time.Minute {
+		t.Errorf("recordingsLastUpdated = %v, want now", tablo.recordingsLastUpdated)
+	}
+
+	// recordings deleted on the Tablo are removed from the cache
+	fake.remove(episodePath("recordings", 500))
+
+	err = tablo.updateRecordings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := queryInt(t, cache, "SELECT count(*) FROM recording"); got != recordings-1 {
+		t.Errorf("%d recordings cached, want %d", got, recordings-1)
+	}
+	if got := queryInt(t, cache, "SELECT count(*) FROM recording WHERE recordingID = 500"); got != 0 {
+		t.Errorf("deleted recording still cached")
+	}
+}
+
+func TestEnqueueExports(t *testing.T) {
+	airDate := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+
+	fake, _ := newGuideTablo(t)
+	fake.addChannel("recordings", 100, "WAAA")
+	fake.addSeries("recordings", 400, "First Show", 200)
+	fake.addRecording(500, 400, 100, airDate)
+	fake.addRecording(501, 400, 100, airDate.Add(time.Hour))
+	fake.addRecording(502, 400, 100, airDate.Add(2*time.Hour))
+
+	tablo, cache := newTestTablo(t, fake)
+	tablo.defaultExportPath = t.TempDir()
+
+	err := tablo.updateGuide()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 500 was exported somewhere other than the default export path and 501 is
+	// a library file that was not exported by the app
+	_, err = cache.Exec(`
+INSERT INTO exported (fullPath, recordingID, verification)
+VALUES
+  ('s3://bucket/tv/recording.mp4', 500, 'verified'),
+  ('/library/First Show/Season 1/First Show - S01E501.mkv', NULL, NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// updateRecordings queues the exports, and running it again must not queue
+	// them twice
+	for i := 0; i < 2; i++ {
+		err = tablo.updateRecordings()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := queryInt(t, cache, "SELECT count(*) FROM queue WHERE action = 'EXPORT'"); got != 1 {
+		t.Errorf("%d exports queued, want 1", got)
+	}
+	if got := queryInt(t, cache, "SELECT count(*) FROM queue WHERE action = 'EXPORT' AND details = '502'"); got != 1 {
+		t.Errorf("recording 502 not queued for export")
+	}
+}
+
+func TestAutoresolveConflicts(t *testing.T) {
+	t.Run("unschedules lowest priority", func(t *testing.T) {
+		fake, _ := newGuideTablo(t)
+		tablo, cache := newTestTablo(t, fake)
+
+		err := tablo.updateGuide()
+		if err != nil {
+			t.Fatal(err)
+		}
+		setPriorities(t, cache, map[int]int{200: 1, 201: 2, 202: 3})
+
+		err = tablo.autoresolveConflicts()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		patches := fake.patched()
+		want := fakeRequest{path: episodePath("guide", 302), body: `{"scheduled": false}`}
+		if len(patches) != 1 || patches[0] != want {
+			t.Fatalf("PATCH requests = %v, want %v", patches, want)
+		}
+		if got := airingState(t, cache, 302); got != "none" {
+			t.Errorf("airing 302 is %s, want none", got)
+		}
+		if got := airingState(t, cache, 300); got != "scheduled" {
+			t.Errorf("airing 300 is %s, want scheduled", got)
+		}
+	})
+
+	t.Run("airing gone from tablo", func(t *testing.T) {
+		fake, _ := newGuideTablo(t)
+		tablo, cache := newTestTablo(t, fake)
+
+		err := tablo.updateGuide()
+		if err != nil {
+			t.Fatal(err)
+		}
+		setPriorities(t, cache, map[int]int{200: 3, 201: 2, 202: 1})
+		fake.remove(episodePath("guide", 300))
+
+		err = tablo.autoresolveConflicts()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if patches := fake.patched(); len(patches) != 1 || patches[0].path != episodePath("guide", 300) {
+			t.Fatalf("PATCH requests = %v, want one for airing 300", patches)
+		}
+		if got := queryInt(t, cache, "SELECT count(*) FROM airing WHERE airingID = 300"); got != 0 {
+			t.Errorf("airing 300 still cached")
+		}
+	})
+
+	t.Run("no priority", func(t *testing.T) {
+		fake, _ := newGuideTablo(t)
+		tablo, cache := newTestTablo(t, fake)
+
+		err := tablo.updateGuide()
+		if err != nil {
+			t.Fatal(err)
+		}
+		setPriorities(t, cache, map[int]int{200: 1, 201: 2})
+
+		err = tablo.autoresolveConflicts()
+		if err == nil {
+			t.Fatal("conflict with a show without priority was resolved")
+		}
+
+		if patches := fake.patched(); len(patches) != 0 {
+			t.Errorf("PATCH requests = %v, want none", patches)
+		}
+		if got := airingState(t, cache, 302); got != "conflict" {
+			t.Errorf("airing 302 is %s, want conflict", got)
+		}
+	})
+}
+
+func TestOpenOffline(t *testing.T) {
+	fake, _ := newGuideTablo(t)
+	dir := t.TempDir()
+	online := openTestTablo(t, fake, dir)
+
+	err := online.updateGuide()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = online.database.RaiseAlert("EXPORTSPACE", "/exports", "exports to /exports are waiting for free space")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := online.ScheduledAirings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tablos, err := OpenOffline(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tablo := range tablos {
+		t.Cleanup(tablo.Close)
+	}
+
+	if len(tablos) != 1 {
+		t.Fatalf("%d caches opened, want 1", len(tablos))
+	}
+	tablo := tablos[0]
+
+	if !tablo.Offline() {
+		t.Error("cache opened by OpenOffline is not offline")
+	}
+	if err := tablo.ProcessQueue(); !errors.Is(err, errOffline) {
+		t.Errorf("ProcessQueue() = %v, want %v", err, errOffline)
+	}
+
+	got, err := tablo.ScheduledAirings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("offline scheduled airings = %+v, want %+v", got, want)
+	}
+
+	// the cache only keeps whole seconds
+	if guideLastUpdated, _, _ := tablo.LastUpdated(); guideLastUpdated.Unix() != online.guideLastUpdated.Unix() {
+		t.Errorf("offline guide last updated = %v, want %v", guideLastUpdated, online.guideLastUpdated)
+	}
+
+	alerts, err := tablo.Alerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].AlertType != "EXPORTSPACE" || alerts[0].Details != "/exports" {
+		t.Errorf("offline alerts = %+v, want one EXPORTSPACE alert for /exports", alerts)
+	}
+
+	report, err := tablo.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report, "3 scheduled airings") || !strings.Contains(report, "EXPORTSPACE alert") {
+		t.Errorf("report = %q", report)
+	}
+}
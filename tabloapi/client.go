@@ -0,0 +1,459 @@
+package tabloapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRequestTimeout is used when a Client is given no timeout
+const DefaultRequestTimeout = 60 * time.Second
+
+const requestAttempts = 4
+
+// retryBackoff is how long to wait before sending a failed request again. It
+// doubles after each attempt, up to maxRetryBackoff.
+var retryBackoff = 2 * time.Second
+
+const maxRetryBackoff = 30 * time.Second
+
+// DefaultBatchWorkers is used when a Client is given no batch worker count
+const DefaultBatchWorkers = 4
+
+const batchSize = 50
+const batchAttempts = 3
+
+// port is where legacy Tablos serve their API
+const port = "8885"
+
+// Client calls the API of one Tablo. A request fails if no data is received
+// for the timeout, and failed requests are retried with jittered exponential
+// backoff. Any status other than 2xx is an *APIError, and a Tablo that still
+// has not answered after every attempt is ErrUnreachable. A Client is safe to
+// use from several goroutines.
+type Client struct {
+	http         *http.Client
+	timeout      time.Duration
+	batchWorkers int
+	log          *log.Logger
+	addressLock  sync.RWMutex
+	address      string
+	unreachable  func(address string) bool
+}
+
+// NewClient creates a client for the Tablo at address, an IP address or, for
+// a Tablo (or a stand-in) not on port 8885, host:port
+func NewClient(address string, timeout time.Duration, batchWorkers int, clientLog *log.Logger) *Client {
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	if batchWorkers < 1 {
+		batchWorkers = DefaultBatchWorkers
+	}
+
+	return &Client{
+		http:         &http.Client{},
+		timeout:      timeout,
+		batchWorkers: batchWorkers,
+		log:          clientLog,
+		address:      address,
+	}
+}
+
+// Address returns the address requests are currently sent to
+func (c *Client) Address() string {
+	c.addressLock.RLock()
+	defer c.addressLock.RUnlock()
+
+	return c.address
+}
+
+// SetAddress sends all later requests to a new address
+func (c *Client) SetAddress(address string) {
+	c.addressLock.Lock()
+	defer c.addressLock.Unlock()
+
+	c.address = address
+}
+
+// OnUnreachable sets a function to call when the Tablo cannot be reached at
+// address. If it returns true, the address has been changed with SetAddress
+// and the request is sent once more. Set it before the client is used.
+func (c *Client) OnUnreachable(f func(address string) bool) {
+	c.unreachable = f
+}
+
+func baseURL(address string) string {
+	_, _, err := net.SplitHostPort(address)
+	if err == nil {
+		return "http://" + address
+	}
+	return "http://" + net.JoinHostPort(address, port)
+}
+
+// request sends a request to path on the Tablo. If the Tablo cannot be
+// reached there and the OnUnreachable function finds it somewhere else, the
+// request is sent once more to the new address.
+func (c *Client) request(ctx context.Context, method string, path string, data []byte, handle func(body io.Reader) error) ([]byte, error) {
+	address := c.Address()
+	body, err := c.send(ctx, method, baseURL(address)+path, data, nil, handle)
+	if !errors.Is(err, ErrUnreachable) || c.unreachable == nil || !c.unreachable(address) {
+		return body, err
+	}
+
+	return c.send(ctx, method, baseURL(c.Address())+path, data, nil, handle)
+}
+
+// getJSON gets path from the Tablo and decodes the response into v
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	return c.sendJSON(ctx, http.MethodGet, path, nil, v)
+}
+
+func (c *Client) sendJSON(ctx context.Context, method string, path string, data []byte, v any) error {
+	body, err := c.request(ctx, method, path, data, nil)
+	if err != nil {
+		return err
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("json.Unmarshal error in sendJSON: %v", err)
+	}
+
+	return nil
+}
+
+// Batch gets the objects at the paths in input from the Tablo's /batch
+// endpoint and passes each one to handle, keyed by path. The paths are sent in
+// chunks of batchSize, up to batchWorkers chunks at a time, so handle must be
+// safe to call from several goroutines. A chunk is only handed over once all
+// of it has been read, and chunks that fail are retried on their own once the
+// rest are done, so one bad chunk does not throw away the others and no object
+// is handled twice. An error from handle stops the batch.
+func (c *Client) Batch(ctx context.Context, input []string, handle func(key string, value json.RawMessage) error) error {
+	var chunks [][]string
+	for i := 0; i < len(input); i += batchSize {
+		j := min(i+batchSize, len(input))
+		chunks = append(chunks, input[i:j])
+	}
+
+	total := len(chunks)
+	for attempt := 1; len(chunks) > 0; attempt++ {
+		failed, err := c.batchChunks(ctx, chunks, handle)
+		if len(failed) == 0 {
+			break
+		}
+
+		var handlerErr *handlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+
+		if attempt == batchAttempts || ctx.Err() != nil {
+			return fmt.Errorf("%d of %d batch chunks failed: %w", len(failed), total, err)
+		}
+
+		c.log.Printf("%d batch chunks failed (%v). retrying them\n", len(failed), err)
+		chunks = failed
+	}
+
+	return nil
+}
+
+// batchChunks posts chunks to /batch on batchWorkers goroutines. It returns
+// the chunks that failed and the last error, or the handler error that
+// stopped it.
+func (c *Client) batchChunks(ctx context.Context, chunks [][]string, handle func(key string, value json.RawMessage) error) ([][]string, error) {
+	var mu sync.Mutex
+	var failed [][]string
+	var lastErr error
+	var stopped bool
+
+	work := make(chan []string)
+	var wg sync.WaitGroup
+	for range min(c.batchWorkers, len(chunks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range work {
+				mu.Lock()
+				skip := stopped
+				mu.Unlock()
+				if skip {
+					continue
+				}
+
+				err := c.batchChunk(ctx, chunk, handle)
+				if err == nil {
+					continue
+				}
+
+				mu.Lock()
+				var handlerErr *handlerError
+				if !stopped {
+					failed = append(failed, chunk)
+					lastErr = err
+					stopped = errors.As(err, &handlerErr)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, chunk := range chunks {
+		work <- chunk
+	}
+	close(work)
+	wg.Wait()
+
+	return failed, lastErr
+}
+
+// batchChunk posts one chunk and decodes the response an object at a time.
+// Nothing is passed to handle until the whole chunk has been decoded, so a
+// chunk that fails part way through can be retried without handling any of
+// its objects twice.
+func (c *Client) batchChunk(ctx context.Context, chunk []string, handle func(key string, value json.RawMessage) error) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error in batchChunk: %v", err)
+	}
+
+	var keys []string
+	var values []json.RawMessage
+	_, err = c.request(ctx, http.MethodPost, "/batch", data, func(body io.Reader) error {
+		// a retried attempt starts the chunk again
+		keys = make([]string, 0, len(chunk))
+		values = make([]json.RawMessage, 0, len(chunk))
+
+		decoder := json.NewDecoder(body)
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("json.Decoder error in batchChunk: %v", err)
+		}
+		if token != json.Delim('{') {
+			return errors.New("batch response is not an object")
+		}
+
+		for decoder.More() {
+			token, err = decoder.Token()
+			if err != nil {
+				return fmt.Errorf("json.Decoder error in batchChunk: %v", err)
+			}
+			key, _ := token.(string)
+
+			var value json.RawMessage
+			err = decoder.Decode(&value)
+			if err != nil {
+				return fmt.Errorf("json.Decoder error in batchChunk: %v", err)
+			}
+
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+
+		_, err = decoder.Token()
+		if err != nil {
+			return fmt.Errorf("json.Decoder error in batchChunk: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		err = handle(key, values[i])
+		if err != nil {
+			return &handlerError{err: err}
+		}
+	}
+
+	return nil
+}
+
+// handlerError is an error from the caller's handler rather than the Tablo.
+// Sending the request again would not help, so it is never retried.
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *handlerError) Unwrap() error {
+	return e.err
+}
+
+// transportError is a request that got no answer from the Tablo, or an answer
+// that stopped part way through, as opposed to an answer that was not usable.
+// Only these make a Tablo unreachable.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// send sends a request, retrying it until it succeeds, fails with an error
+// that will not go away on its own, runs out of attempts or ctx is cancelled
+func (c *Client) send(ctx context.Context, method string, uri string, data []byte, wrap func(io.Reader) io.Reader, handle func(body io.Reader) error) ([]byte, error) {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		body, err := c.attempt(ctx, method, uri, data, wrap, handle)
+		if err == nil {
+			return body, nil
+		}
+
+		var apiErr *APIError
+		var handlerErr *handlerError
+		switch {
+		case ctx.Err() != nil:
+			return nil, err
+		case errors.As(err, &handlerErr):
+			return nil, err
+		case errors.As(err, &apiErr) && !retryable(apiErr):
+			return nil, err
+		case attempt == requestAttempts:
+			c.log.Printf("%s %s failed after %d attempts\n", method, uri, attempt)
+			// a Tablo that answered with something unusable is still there
+			var transportErr *transportError
+			if errors.As(err, &transportErr) {
+				err = fmt.Errorf("%w: %w", ErrUnreachable, err)
+			}
+			return nil, err
+		}
+
+		// full jitter between half and all of the backoff, so Tablos that fail
+		// together don't retry together
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		c.log.Printf("%s %s failed (%v). retrying in %v\n", method, uri, err, wait.Round(time.Millisecond))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// attempt sends a request once. The request is cancelled if timeout passes
+// without receiving any data, so a slow but working download is not cut off.
+func (c *Client) attempt(ctx context.Context, method string, uri string, data []byte, wrap func(io.Reader) io.Reader, handle func(body io.Reader) error) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(c.timeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	var requestBody io.Reader
+	if data != nil {
+		requestBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest error in attempt: %v", err)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if timedOut.Load() {
+			return nil, &transportError{err: fmt.Errorf("no response from %s in %v: %w", uri, c.timeout, err)}
+		}
+		return nil, &transportError{err: err}
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = &idleReader{r: resp.Body, timer: timer, timeout: c.timeout}
+	if wrap != nil {
+		reader = wrap(reader)
+	}
+	if handle != nil && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		err = handle(reader)
+		if err != nil && timedOut.Load() {
+			return nil, &transportError{err: fmt.Errorf("%s stopped sending data for %v", uri, c.timeout)}
+		}
+		return nil, err
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		if timedOut.Load() {
+			return nil, &transportError{err: fmt.Errorf("%s stopped sending data for %v", uri, c.timeout)}
+		}
+		return nil, fmt.Errorf("io.ReadAll error in attempt: %v", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		apiErr := &APIError{Method: method, URI: uri, StatusCode: resp.StatusCode}
+
+		// the Tablo explains most errors in the body
+		var errorBody struct {
+			Error RequestError `json:"error"`
+		}
+		if json.Unmarshal(body, &errorBody) == nil {
+			apiErr.Code = errorBody.Error.Code
+			apiErr.Description = errorBody.Error.Description
+		}
+
+		return nil, apiErr
+	}
+
+	return body, nil
+}
+
+// retryable reports whether the same request might succeed later
+func retryable(err *APIError) bool {
+	return err.StatusCode >= http.StatusInternalServerError || err.StatusCode == http.StatusTooManyRequests
+}
+
+// idleReader pushes back the request timeout every time data arrives
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
@@ -0,0 +1,71 @@
+package tabloapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for server that retries without waiting and
+// counts the times it is reported unreachable
+func newTestClient(t *testing.T, server *httptest.Server) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	backoff := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = backoff })
+
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"), time.Second, 1, log.New(io.Discard, "", 0))
+	var unreachable atomic.Int32
+	client.OnUnreachable(func(address string) bool {
+		unreachable.Add(1)
+		return false
+	})
+
+	return client, &unreachable
+}
+
+func TestBatchMalformedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"/recordings/airings/1": {"object_id": 1}, "/recordings/airings/2": `)
+	}))
+	defer server.Close()
+
+	client, unreachable := newTestClient(t, server)
+
+	err := client.Batch(context.Background(), []string{"/recordings/airings/1", "/recordings/airings/2"}, func(key string, value json.RawMessage) error {
+		t.Errorf("%s handled from a malformed response", key)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Batch() of a malformed response succeeded")
+	}
+	if errors.Is(err, ErrUnreachable) {
+		t.Errorf("Batch() = %v, want an error that is not ErrUnreachable", err)
+	}
+	if n := unreachable.Load(); n != 0 {
+		t.Errorf("reported unreachable %d times for a Tablo that answered", n)
+	}
+}
+
+func TestServerInfoUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	client, unreachable := newTestClient(t, server)
+	server.Close()
+
+	_, err := client.ServerInfo(context.Background())
+	if !errors.Is(err, ErrUnreachable) {
+		t.Errorf("ServerInfo() = %v, want ErrUnreachable", err)
+	}
+	if n := unreachable.Load(); n != 1 {
+		t.Errorf("reported unreachable %d times, want 1", n)
+	}
+}
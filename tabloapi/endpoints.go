@@ -0,0 +1,156 @@
+package tabloapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// WebLookupURL is the Tablo web service that lists the Tablos on the caller's
+// network
+const WebLookupURL = "https://api.tablotv.com/assocserver/getipinfo/"
+
+// the path of each show type's airings under /guide and /recordings
+var showTypePaths = map[string]string{
+	"series": "/series/episodes",
+	"movies": "/movies/airings",
+	"sports": "/sports/events",
+}
+
+func objectPath(section string, showType string, objectID int) (string, error) {
+	showTypePath, ok := showTypePaths[showType]
+	if !ok {
+		return "", fmt.Errorf("unknown show type %s", showType)
+	}
+
+	return "/" + section + showTypePath + "/" + strconv.Itoa(objectID), nil
+}
+
+// Lookup asks the Tablo web service for the Tablos on this network
+func Lookup(ctx context.Context, lookupLog *log.Logger) ([]TabloDetails, error) {
+	c := NewClient("", 0, 0, lookupLog)
+	body, err := c.send(ctx, http.MethodGet, WebLookupURL, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp WebAPIResp
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error in Lookup: %v", err)
+	}
+
+	return resp.Cpes, nil
+}
+
+func (c *Client) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	var info ServerInfo
+	err := c.getJSON(ctx, "/server/info", &info)
+	return info, err
+}
+
+func (c *Client) HardDrives(ctx context.Context) ([]Drive, error) {
+	var drives []Drive
+	err := c.getJSON(ctx, "/server/harddrives", &drives)
+	return drives, err
+}
+
+// GuideChannels lists the paths of the channels in the guide. Details for the
+// paths are read with Batch, as are those of the other lists.
+func (c *Client) GuideChannels(ctx context.Context) ([]string, error) {
+	return c.getPaths(ctx, "/guide/channels")
+}
+
+func (c *Client) GuideShows(ctx context.Context) ([]string, error) {
+	return c.getPaths(ctx, "/guide/shows")
+}
+
+// GuideAirings lists the paths of the airings in the guide in state (e.g.
+// scheduled or conflicted), or of every airing if state is ""
+func (c *Client) GuideAirings(ctx context.Context, state string) ([]string, error) {
+	path := "/guide/airings"
+	if state != "" {
+		path += "?state=" + url.QueryEscape(state)
+	}
+	return c.getPaths(ctx, path)
+}
+
+func (c *Client) RecordingChannels(ctx context.Context) ([]string, error) {
+	return c.getPaths(ctx, "/recordings/channels")
+}
+
+func (c *Client) RecordingShows(ctx context.Context) ([]string, error) {
+	return c.getPaths(ctx, "/recordings/shows")
+}
+
+func (c *Client) RecordingAirings(ctx context.Context) ([]string, error) {
+	return c.getPaths(ctx, "/recordings/airings")
+}
+
+// Unschedule stops an airing from being recorded and returns the airing as
+// updated. An airing that no longer exists is ErrNotFound.
+func (c *Client) Unschedule(ctx context.Context, showType string, airingID int) (Airing, error) {
+	var airing Airing
+	path, err := objectPath("guide", showType, airingID)
+	if err != nil {
+		return airing, err
+	}
+
+	err = c.sendJSON(ctx, http.MethodPatch, path, []byte(`{"scheduled": false}`), &airing)
+	if err != nil {
+		return airing, err
+	}
+
+	return airing, airing.Error.Err()
+}
+
+// Watch starts a stream of a recording. The playlist URL in the result can be
+// read with Fetch.
+func (c *Client) Watch(ctx context.Context, showType string, recordingID int) (Watch, error) {
+	var watch Watch
+	path, err := objectPath("recordings", showType, recordingID)
+	if err != nil {
+		return watch, err
+	}
+
+	err = c.sendJSON(ctx, http.MethodPost, path+"/watch", []byte{}, &watch)
+	return watch, err
+}
+
+func (c *Client) ComSkip(ctx context.Context, showType string, recordingID int) (ComSkipMarkers, error) {
+	var markers ComSkipMarkers
+	path, err := objectPath("recordings", showType, recordingID)
+	if err != nil {
+		return markers, err
+	}
+
+	err = c.getJSON(ctx, path+"/comskip", &markers)
+	return markers, err
+}
+
+func (c *Client) DeleteRecording(ctx context.Context, showType string, recordingID int) error {
+	path, err := objectPath("recordings", showType, recordingID)
+	if err != nil {
+		return err
+	}
+
+	return c.sendJSON(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// Fetch gets a URL handed out by the Tablo, like a playlist or video segment.
+// If wrap is not nil, the response is read through the reader it returns
+// (e.g. to limit bandwidth).
+func (c *Client) Fetch(ctx context.Context, uri string, wrap func(io.Reader) io.Reader) ([]byte, error) {
+	return c.send(ctx, http.MethodGet, uri, nil, wrap, nil)
+}
+
+func (c *Client) getPaths(ctx context.Context, path string) ([]string, error) {
+	var paths []string
+	err := c.getJSON(ctx, path, &paths)
+	return paths, err
+}
@@ -0,0 +1,57 @@
+package tabloapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors shared by the tabloapi, tablodb and tablo packages. Check for them
+// with errors.Is.
+var (
+	// ErrEmptyResult means a request or query succeeded but returned nothing
+	ErrEmptyResult = errors.New("empty result")
+	// ErrNotFound means the requested object does not exist
+	ErrNotFound = errors.New("object not found")
+	// ErrUnreachable means the Tablo did not respond
+	ErrUnreachable = errors.New("tablo unreachable")
+)
+
+// APIError is an error reported by the Tablo API, either as a status other
+// than 2xx or as an error object in the response. Use errors.As to get the
+// code.
+type APIError struct {
+	Method      string
+	URI         string
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *APIError) Error() string {
+	message := "tablo api error"
+	if e.Method != "" {
+		message = fmt.Sprintf("http.%s %s returned %d", e.Method, e.URI, e.StatusCode)
+	}
+	if e.Code != "" {
+		message += " " + e.Code
+	}
+	if e.Description != "" {
+		message += ": " + e.Description
+	}
+	return message
+}
+
+// Is makes an object_not_found error (or a 404) match ErrNotFound
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && (e.Code == "object_not_found" || e.StatusCode == http.StatusNotFound)
+}
+
+// Err returns the error object in a response as an *APIError, or nil if there
+// is none
+func (e RequestError) Err() error {
+	if e.Code == "" {
+		return nil
+	}
+	return &APIError{StatusCode: http.StatusOK, Code: e.Code, Description: e.Description}
+}
@@ -10,6 +10,19 @@ type TabloDetails struct {
 	PrivateIP string `json:"private_ip"`
 }
 
+type ServerInfo struct {
+	ServerID     string `json:"server_id"`
+	Name         string `json:"name"`
+	Timezone     string `json:"timezone"`
+	Version      string `json:"version"`
+	LocalAddress string `json:"local_address"`
+	Model        struct {
+		Name   string `json:"name"`
+		Device string `json:"device"`
+		Tuners int    `json:"tuners"`
+	} `json:"model"`
+}
+
 type Channel struct {
 	ObjectID int            `json:"object_id"`
 	Channel  ChannelDetails `json:"channel"`
@@ -166,3 +179,19 @@ type RequestError struct {
 	Details     int    `json:"details"`
 	Description string `json:"description"`
 }
+
+type Watch struct {
+	Token       string `json:"token"`
+	Expires     string `json:"expires"`
+	PlaylistURL string `json:"playlist_url"`
+}
+
+type ComSkipMarkers struct {
+	State       string       `json:"state"`
+	Commercials []Commercial `json:"commercials"`
+}
+
+type Commercial struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
@@ -2,12 +2,15 @@ package tablodb
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davidw1457/tablo-manager/stringmanip"
@@ -18,9 +21,28 @@ import (
 
 const userRWX = 0700 // unix-style octal permission
 
+// The errors shared with tabloapi and tablo. Lookups of a single row return
+// ErrNotFound (wrapping sql.ErrNoRows) when there is no such row.
+var (
+	ErrEmptyResult = tabloapi.ErrEmptyResult
+	ErrNotFound    = tabloapi.ErrNotFound
+)
+
+// exports write to the cache while queue updates are running. wait for the
+// lock rather than failing with SQLITE_BUSY
+const busyTimeout = "?_busy_timeout=30000"
+
 type TabloDB struct {
 	database *sql.DB
 	log      *log.Logger
+	prepared *preparedStatements
+}
+
+// preparedStatements holds the statements prepared so far, by name. It is
+// shared by every copy of a TabloDB.
+type preparedStatements struct {
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
 }
 
 type QueueRecord struct {
@@ -39,6 +61,111 @@ type ScheduledAiringRecord struct {
 	Episode      int
 	EpisodeTitle string
 	ReleaseYear  int
+	OrigAirDate  int
+	CallSign     string
+	Teams        string
+}
+
+type RecordingRecord struct {
+	RecordingID       int
+	AirDate           int
+	ShowType          string
+	ShowTitle         string
+	Season            string
+	Episode           int
+	EpisodeTitle      string
+	ReleaseYear       int
+	RecordingState    string
+	RecordingDuration int
+	RecordingSize     int
+	ShowID            int
+	EpisodeID         string
+	ComSkipState      string
+	CallSign          string
+	Teams             string
+}
+
+type ExportProgressRecord struct {
+	QueueID           int
+	RecordingID       int
+	TempFile          string
+	SegmentsCompleted int
+	BytesWritten      int64
+	Checksum          string
+}
+
+type ExportedRecord struct {
+	FullPath     string
+	RecordingID  int
+	Verification string
+	FileSize     int64
+	FileDuration int
+}
+
+type DeleteAuditRecord struct {
+	RecordingID int
+	ShowID      int
+	EpisodeID   string
+	ShowTitle   string
+	FullPath    string
+	DeletedAt   time.Time
+	Result      string
+}
+
+type ExportHookRecord struct {
+	HookID    int
+	Command   string
+	OnSuspect bool
+}
+
+type QueueHistoryRecord struct {
+	QueueID    int
+	Action     string
+	Details    string
+	ExportPath string
+	Result     string
+	ExitStatus *int
+	Output     string
+	FinishedAt time.Time
+}
+
+type AlertRecord struct {
+	AlertID   int
+	AlertType string
+	Details   string
+	Message   string
+	RaisedAt  time.Time
+}
+
+type ShowMetadataRecord struct {
+	ShowID      int
+	ShowType    string
+	Title       string
+	Description string
+	ReleaseDate int
+	OrigRunTime int
+	Rating      string
+	Genres      []string
+	Cast        []string
+	Directors   []string
+	Awards      []AwardRecord
+}
+
+type AwardRecord struct {
+	Won      bool
+	Name     string
+	Category string
+	Year     int
+	Nominee  string
+}
+
+type EpisodeMetadataRecord struct {
+	EpisodeID       string
+	Title           string
+	Description     string
+	Episode         int
+	Season          string
+	OriginalAirDate int
 }
 
 type PrioritizedConflictRecord struct {
@@ -67,13 +194,14 @@ func New(ipAddress string, name string, serverID string, directory string) (Tabl
 
 	databaseFile := directory + string(os.PathSeparator) + stringmanip.SanitizeFile(serverID) + ".cache"
 	tabloDB.log.Printf("creating %s\n", databaseFile)
-	db, err := sql.Open("sqlite3", databaseFile)
+	db, err := sql.Open("sqlite3", databaseFile+busyTimeout)
 	if err != nil {
 		tabloDB.log.Println(err)
 		return tabloDB, err
 	}
 
 	tabloDB.database = db
+	tabloDB.prepared = &preparedStatements{stmts: make(map[string]*sql.Stmt)}
 
 	tabloDB.log.Println("performing initial setup")
 	err = tabloDB.initialSetup()
@@ -83,11 +211,8 @@ func New(ipAddress string, name string, serverID string, directory string) (Tabl
 	}
 
 	tabloDB.log.Println("upserting systemInfo")
-	qryUpsertSystemInfo := fmt.Sprintf(templates["upsertSystemInfo"], stringmanip.SanitizeSql(serverID), stringmanip.SanitizeSql(name), stringmanip.SanitizeSql(ipAddress), dbVer)
-	_, err = tabloDB.database.Exec(qryUpsertSystemInfo)
+	err = tabloDB.exec("upsertSystemInfo", serverID, name, ipAddress, dbVer)
 	if err != nil {
-		tabloDB.log.Println(qryUpsertSystemInfo)
-		tabloDB.log.Println(err)
 		return tabloDB, err
 	}
 
@@ -106,13 +231,14 @@ func Open(serverID string, ipAddress string, name string, directory string) (Tab
 	tabloDB.log.Println("opening tabloDB")
 	databaseFile := directory + string(os.PathSeparator) + stringmanip.SanitizeFile(serverID) + ".cache"
 	tabloDB.log.Printf("opening %s\n", databaseFile)
-	db, err := sql.Open("sqlite3", databaseFile)
+	db, err := sql.Open("sqlite3", databaseFile+busyTimeout)
 	if err != nil {
 		tabloDB.log.Println(err)
 		return tabloDB, err
 	}
 
 	tabloDB.database = db
+	tabloDB.prepared = &preparedStatements{stmts: make(map[string]*sql.Stmt)}
 
 	tabloDB.log.Println("verifying database version")
 	currentDBVer, err := tabloDB.getVersion()
@@ -130,11 +256,8 @@ func Open(serverID string, ipAddress string, name string, directory string) (Tab
 	}
 
 	tabloDB.log.Println("updating systemInfo")
-	qryUpdateSystemInfo := fmt.Sprintf(templates["updateSystemInfo"], stringmanip.SanitizeSql(name), stringmanip.SanitizeSql(ipAddress))
-	_, err = tabloDB.database.Exec(qryUpdateSystemInfo)
+	err = tabloDB.exec("updateSystemInfo", name, ipAddress)
 	if err != nil {
-		tabloDB.log.Println(qryUpdateSystemInfo)
-		tabloDB.log.Println(err)
 		return tabloDB, err
 	}
 
@@ -142,9 +265,63 @@ func Open(serverID string, ipAddress string, name string, directory string) (Tab
 	return tabloDB, nil
 }
 
+// OpenReadOnly opens an existing cache without changing it, for use when its
+// Tablo cannot be reached. A cache from an older version cannot be upgraded
+// read-only, so it is not opened.
+func OpenReadOnly(serverID string, directory string) (TabloDB, error) {
+	var tabloDB TabloDB
+	logFile, err := os.OpenFile(directory+string(os.PathSeparator)+"main.log", os.O_WRONLY|os.O_APPEND|os.O_CREATE, userRWX)
+	if err != nil {
+		return tabloDB, err
+	}
+	tabloDB.log = log.New(io.MultiWriter(logFile, os.Stdout), "tablodb "+serverID+": ", log.LstdFlags)
+
+	databaseFile := directory + string(os.PathSeparator) + stringmanip.SanitizeFile(serverID) + ".cache"
+	tabloDB.log.Printf("opening %s read-only\n", databaseFile)
+	_, err = os.Stat(databaseFile)
+	if err != nil {
+		tabloDB.log.Println(err)
+		return tabloDB, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+filepath.ToSlash(databaseFile)+busyTimeout+"&mode=ro")
+	if err != nil {
+		tabloDB.log.Println(err)
+		return tabloDB, err
+	}
+
+	tabloDB.database = db
+	tabloDB.prepared = &preparedStatements{stmts: make(map[string]*sql.Stmt)}
+
+	tabloDB.log.Println("verifying database version")
+	currentDBVer, err := tabloDB.getVersion()
+	if err != nil {
+		tabloDB.log.Println(err)
+		db.Close()
+		return tabloDB, err
+	}
+
+	if currentDBVer < dbVer {
+		err = fmt.Errorf("%s is version %d and needs an upgrade to version %d. open it with a Tablo online first", databaseFile, currentDBVer, dbVer)
+		tabloDB.log.Println(err)
+		db.Close()
+		return tabloDB, err
+	}
+
+	tabloDB.log.Println("tabloDB opened read-only")
+	return tabloDB, nil
+}
+
 func (db *TabloDB) Close() {
 	db.log.Println("closing database")
 	defer db.database.Close()
+
+	db.prepared.mu.Lock()
+	defer db.prepared.mu.Unlock()
+	for name, stmt := range db.prepared.stmts {
+		stmt.Close()
+		delete(db.prepared.stmts, name)
+	}
 }
 
 func (db *TabloDB) initialSetup() error {
@@ -188,27 +365,25 @@ func (db *TabloDB) GetScheduledLastUpdated() (time.Time, error) {
 
 func (db *TabloDB) Enqueue(action string, details string, exportPath string) error {
 	db.log.Printf("enqueueing '%s' '%s' '%s'\n", action, details, exportPath)
-	var qry string
+	insert := "insertQueue"
 	if details == "" {
-		qrySelectQueueRecordByAction := fmt.Sprintf(templates["selectQueueRecordByAction"], stringmanip.SanitizeSql(action))
+		stmt, err := db.stmt("selectQueueRecordByAction")
+		if err != nil {
+			return err
+		}
 		var count int
-		err := db.database.QueryRow(qrySelectQueueRecordByAction).Scan(&count)
+		err = stmt.QueryRow(action).Scan(&count)
 		if err != nil {
-			db.log.Println(qry)
+			db.log.Println(statements["selectQueueRecordByAction"])
 			db.log.Println(err)
 			return err
-		} else if count == 0 {
-			qry = fmt.Sprintf(templates["insertQueuePriority"], stringmanip.SanitizeSql(action), stringmanip.SanitizeSql(details), stringmanip.SanitizeSql(exportPath))
-		} else {
+		} else if count > 0 {
 			return nil
 		}
-	} else {
-		qry = fmt.Sprintf(templates["insertQueue"], stringmanip.SanitizeSql(action), stringmanip.SanitizeSql(details), stringmanip.SanitizeSql(exportPath))
+		insert = "insertQueuePriority"
 	}
-	_, err := db.database.Exec(qry)
+	err := db.exec(insert, action, details, exportPath)
 	if err != nil {
-		db.log.Println(qry)
-		db.log.Println(err)
 		return err
 	}
 	db.log.Println("enqueued successfully")
@@ -240,48 +415,30 @@ func (db *TabloDB) GetQueue() ([]QueueRecord, error) {
 
 func (db *TabloDB) UpsertChannels(channels map[string]tabloapi.Channel) error {
 	db.log.Printf("preparing %d channels to insert\n", len(channels))
-	var channelValues []string
+	var channelRows [][]any
 	for k, v := range channels {
 		if v.ObjectID == 0 {
 			continue
 		}
 
 		updateType := strings.Split(k, "/")[1]
-		network := "null"
-		if v.Channel.Network != nil {
-			network = "'" + stringmanip.SanitizeSql(*v.Channel.Network) + "'"
-		}
-		var channelValue strings.Builder
-		channelValue.WriteRune('(')
+		channelID := v.ObjectID
 		if updateType == "recordings" {
-			channelValue.WriteString("-" + strconv.Itoa(v.ObjectID))
-		} else {
-			channelValue.WriteString(strconv.Itoa(v.ObjectID))
+			channelID = -channelID
 		}
-		channelValue.WriteString(",'")
-		channelValue.WriteString(stringmanip.SanitizeSql(v.Channel.CallSign))
-		channelValue.WriteString("',")
-		channelValue.WriteString(strconv.Itoa(v.Channel.Major))
-		channelValue.WriteRune(',')
-		channelValue.WriteString(strconv.Itoa(v.Channel.Minor))
-		channelValue.WriteString(",")
-		channelValue.WriteString(network) // Previously sanitized
-		channelValue.WriteRune(')')
-		channelValues = append(channelValues, channelValue.String())
-	}
-
-	if len(channelValues) == 0 {
+
+		channelRows = append(channelRows, []any{channelID, v.Channel.CallSign, v.Channel.Major, v.Channel.Minor, v.Channel.Network})
+	}
+
+	if len(channelRows) == 0 {
 		err := fmt.Errorf("No channels in insert values")
 		db.log.Println(err)
 		return err
 	}
 
-	db.log.Printf("upserting %d channels\n", len(channelValues))
-	qry := fmt.Sprintf(templates["upsertChannel"], strings.Join(channelValues, ","))
-	_, err := db.database.Exec(qry)
+	db.log.Printf("upserting %d channels\n", len(channelRows))
+	err := db.execRows("upsertChannel", channelRows)
 	if err != nil {
-		db.log.Println(qry)
-		db.log.Println(err)
 		return err
 	}
 
@@ -291,11 +448,11 @@ func (db *TabloDB) UpsertChannels(channels map[string]tabloapi.Channel) error {
 
 func (db *TabloDB) UpsertShows(shows map[string]tabloapi.Show) error {
 	db.log.Printf("preparing %d shows to insert\n", len(shows))
-	var showGenreValues []string
-	var showCastMemberValues []string
-	var showAwardValues []string
-	var showDirectorValues []string
-	var showValues []string
+	var showGenreRows [][]any
+	var showCastMemberRows [][]any
+	var showAwardRows [][]any
+	var showDirectorRows [][]any
+	var showRows [][]any
 	for k, s := range shows {
 		if s.ObjectID == 0 {
 			continue
@@ -303,32 +460,32 @@ func (db *TabloDB) UpsertShows(shows map[string]tabloapi.Show) error {
 
 		updateType := strings.Split(k, "/")[1]
 
-		showID := strconv.Itoa(s.ObjectID)
+		showID := s.ObjectID
 		if updateType == "recordings" {
-			showID = "-" + showID
+			showID = -showID
 		}
 
-		parentShowID := "null"
+		var parentShowID any
 		if s.GuidePath != "" {
-			parentShowID = strings.Split(s.GuidePath, "/")[3]
-		}
-
-		rule := "null"
-		if s.Schedule.Rule != "" {
-			rule = "'" + stringmanip.SanitizeSql(s.Schedule.Rule) + "'"
+			id, err := pathID(s.GuidePath)
+			if err != nil {
+				db.log.Println(err)
+				return err
+			}
+			parentShowID = id
 		}
 
-		channelID := "null"
+		var channelID any
 		if s.Schedule.ChannelPath != "" {
-			channelID = strings.Split(s.Schedule.ChannelPath, "/")[3]
+			id, err := pathID(s.Schedule.ChannelPath)
+			if err != nil {
+				db.log.Println(err)
+				return err
+			}
 			if updateType == "recordings" {
-				channelID = "-" + channelID
+				id = -id
 			}
-		}
-
-		count := "null"
-		if s.Keep.Count != nil {
-			count = strconv.Itoa(*s.Keep.Count)
+			channelID = id
 		}
 
 		showType := strings.Split(s.Path, "/")[2]
@@ -338,102 +495,39 @@ func (db *TabloDB) UpsertShows(shows map[string]tabloapi.Show) error {
 		var awards []tabloapi.Award
 		var directors []string
 
-		var showValue strings.Builder
-		showValue.WriteRune('(')
-		showValue.WriteString(showID) // Int value, no sanitizaion needed
-		showValue.WriteRune(',')
-		showValue.WriteString(stringmanip.SanitizeSql(parentShowID))
-		showValue.WriteString(",'")
-		showValue.WriteString(stringmanip.SanitizeSql(showType))
-		showValue.WriteString("',")
-		showValue.WriteString(rule) // Previously sanitized
-		showValue.WriteRune(',')
-		showValue.WriteString(stringmanip.SanitizeSql(channelID))
-		showValue.WriteString(",'")
-		showValue.WriteString(stringmanip.SanitizeSql(s.Keep.Rule))
-		showValue.WriteString("',")
-		showValue.WriteString(stringmanip.SanitizeSql(count))
-		showValue.WriteString(",'")
+		showRow := []any{showID, parentShowID, showType, emptyToNull(s.Schedule.Rule), channelID, s.Keep.Rule, s.Keep.Count}
 
 		switch showType {
 		case "series":
-			description := "null"
-			if s.Series.Description != nil {
-				description = "'" + stringmanip.SanitizeSql(*s.Series.Description) + "'"
-			}
-
-			airdate := "null"
+			var airdate any
 			if s.Series.OrigAirDate != nil {
 				airdateInt, err := dateStringToInt(*s.Series.OrigAirDate)
 				if err != nil {
 					db.log.Println(err)
 					return err
 				}
-				airdate = strconv.Itoa(airdateInt)
+				airdate = airdateInt
 			}
 
-			rating := "null"
-			if s.Series.SeriesRating != nil {
-				rating = "'" + stringmanip.SanitizeSql(*s.Series.SeriesRating) + "'"
-			}
-
-			showValue.WriteString(stringmanip.SanitizeSql(s.Series.Title))
-			showValue.WriteString("',")
-			showValue.WriteString(description) // Previously sanitized
-			showValue.WriteRune(',')
-			showValue.WriteString(airdate) // Int value, no sanitization needed
-			showValue.WriteRune(',')
-			showValue.WriteString(strconv.Itoa(s.Series.EpisodeRuntime))
-			showValue.WriteRune(',')
-			showValue.WriteString(rating) // Previously sanitized
-			showValue.WriteString(",null)")
+			showRow = append(showRow, s.Series.Title, s.Series.Description, airdate, s.Series.EpisodeRuntime, s.Series.SeriesRating, nil)
 
 			genres = s.Series.Genres
 			cast = s.Series.Cast
 			awards = s.Series.Awards
 		case "movies":
-			description := "null"
-			if s.Movie.Plot != nil {
-				description = "'" + stringmanip.SanitizeSql(*s.Movie.Plot) + "'"
-			}
-
-			airdate := "null"
+			var airdate any
 			if s.Movie.ReleaseYear != nil {
-				airdate = strconv.Itoa(dateYearToInt(*s.Movie.ReleaseYear))
-			}
-
-			filmRating := "null"
-			if s.Movie.FilmRating != nil {
-				filmRating = "'" + stringmanip.SanitizeSql(*s.Movie.FilmRating) + "'"
-			}
-
-			qualityRating := "null"
-			if s.Movie.QualityRating != nil {
-				qualityRating = strconv.Itoa(*s.Movie.QualityRating)
+				airdate = dateYearToInt(*s.Movie.ReleaseYear)
 			}
 
-			showValue.WriteString(stringmanip.SanitizeSql(s.Movie.Title))
-			showValue.WriteString("',")
-			showValue.WriteString(description) // Previosly sanitized
-			showValue.WriteRune(',')
-			showValue.WriteString(airdate) // Int value, no sanitization needed
-			showValue.WriteRune(',')
-			showValue.WriteString(strconv.Itoa(s.Movie.OriginalRuntime))
-			showValue.WriteRune(',')
-			showValue.WriteString(filmRating) // Previously sanitized
-			showValue.WriteRune(',')
-			showValue.WriteString(qualityRating) // Int value, no sanitization needed
-			showValue.WriteRune(')')
+			showRow = append(showRow, s.Movie.Title, s.Movie.Plot, airdate, s.Movie.OriginalRuntime, s.Movie.FilmRating, s.Movie.QualityRating)
 
 			genres = s.Movie.Genres
 			cast = s.Movie.Cast
 			awards = s.Movie.Awards
 			directors = s.Movie.Directors
 		case "sports":
-			showValue.WriteString(stringmanip.SanitizeSql(s.Sport.Title))
-			showValue.WriteString("','")
-			showValue.WriteString(stringmanip.SanitizeSql(s.Sport.Description))
-			showValue.WriteString("',null,null,null,null)")
+			showRow = append(showRow, s.Sport.Title, s.Sport.Description, nil, nil, nil, nil)
 
 			genres = s.Sport.Genres
 		default:
@@ -442,123 +536,65 @@ func (db *TabloDB) UpsertShows(shows map[string]tabloapi.Show) error {
 			return err
 		}
 
-		showValues = append(showValues, showValue.String())
+		showRows = append(showRows, showRow)
 
 		for _, g := range genres {
-			var genreValue strings.Builder
-			genreValue.WriteRune('(')
-			genreValue.WriteString(showID) // Int value, no sanitization needed
-			genreValue.WriteString(",'")
-			genreValue.WriteString(stringmanip.SanitizeSql(g))
-			genreValue.WriteString("')")
-			showGenreValues = append(showGenreValues, genreValue.String())
+			showGenreRows = append(showGenreRows, []any{showID, g})
 		}
 
 		for _, c := range cast {
-			var castValue strings.Builder
-			castValue.WriteRune('(')
-			castValue.WriteString(showID) // Int value, no sanitization needed
-			castValue.WriteString(",'")
-			castValue.WriteString(stringmanip.SanitizeSql(c))
-			castValue.WriteString("')")
-			showCastMemberValues = append(showCastMemberValues, castValue.String())
+			showCastMemberRows = append(showCastMemberRows, []any{showID, c})
 		}
 
 		for _, d := range directors {
-			var directorValue strings.Builder
-			directorValue.WriteRune('(')
-			directorValue.WriteString(showID) // Int value, no sanitization needed
-			directorValue.WriteString(",'")
-			directorValue.WriteString(stringmanip.SanitizeSql(d))
-			directorValue.WriteString("')")
-			showDirectorValues = append(showDirectorValues, directorValue.String())
+			showDirectorRows = append(showDirectorRows, []any{showID, d})
 		}
 
 		for _, a := range awards {
-			won := "0"
-			if a.Won {
-				won = "1"
-			}
-
-			nominee := "null"
-			if a.Nominee != "" {
-				nominee = "'" + stringmanip.SanitizeSql(a.Nominee) + "'"
-			}
-
-			var awardValue strings.Builder
-			awardValue.WriteRune('(')
-			awardValue.WriteString(showID) // Int value, no sanitization needed
-			awardValue.WriteRune(',')
-			awardValue.WriteString(won) // Bool value, no sanitization needed
-			awardValue.WriteString(",'")
-			awardValue.WriteString(stringmanip.SanitizeSql(a.Name))
-			awardValue.WriteString("','")
-			awardValue.WriteString(stringmanip.SanitizeSql(a.Category))
-			awardValue.WriteString("',")
-			awardValue.WriteString(strconv.Itoa(a.Year))
-			awardValue.WriteRune(',')
-			awardValue.WriteString(nominee) // Previously sanitized
-			awardValue.WriteRune(')')
-
-			showAwardValues = append(showAwardValues, awardValue.String())
+			showAwardRows = append(showAwardRows, []any{showID, a.Won, a.Name, a.Category, a.Year, emptyToNull(a.Nominee)})
 		}
 	}
 
-	if len(showValues) == 0 {
-		err := fmt.Errorf("no shows in upsert values")
+	if len(showRows) == 0 {
+		err := fmt.Errorf("no shows in upsert values: %w", ErrEmptyResult)
 		db.log.Println(err)
 		return err
 	}
 
-	db.log.Printf("Upserting %d shows\n", len(showValues))
-	qryUpsertShow := fmt.Sprintf(templates["upsertShow"], strings.Join(showValues, ","))
-	_, err := db.database.Exec(qryUpsertShow)
+	db.log.Printf("Upserting %d shows\n", len(showRows))
+	err := db.execRows("upsertShow", showRows)
 	if err != nil {
-		db.log.Println(qryUpsertShow)
-		db.log.Println(err)
 		return err
 	}
 
-	if len(showGenreValues) > 0 {
-		db.log.Printf("Inserting %d genres\n", len(showGenreValues))
-		qryInsertShowGenre := fmt.Sprintf(templates["insertShowGenre"], strings.Join(showGenreValues, ","))
-		_, err = db.database.Exec(qryInsertShowGenre)
+	if len(showGenreRows) > 0 {
+		db.log.Printf("Inserting %d genres\n", len(showGenreRows))
+		err = db.execRows("insertShowGenre", showGenreRows)
 		if err != nil {
-			db.log.Println(qryInsertShowGenre)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(showCastMemberValues) > 0 {
-		db.log.Printf("Inserting %d cast members\n", len(showCastMemberValues))
-		qryInsertShowCastMember := fmt.Sprintf(templates["insertShowCastMember"], strings.Join(showCastMemberValues, ","))
-		_, err = db.database.Exec(qryInsertShowCastMember)
+	if len(showCastMemberRows) > 0 {
+		db.log.Printf("Inserting %d cast members\n", len(showCastMemberRows))
+		err = db.execRows("insertShowCastMember", showCastMemberRows)
 		if err != nil {
-			db.log.Println(qryInsertShowCastMember)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(showAwardValues) > 0 {
-		db.log.Printf("Upserting %d awards\n", len(showAwardValues))
-		qryUpsertShowAward := fmt.Sprintf(templates["upsertShowAward"], strings.Join(showAwardValues, ","))
-		_, err = db.database.Exec(qryUpsertShowAward)
+	if len(showAwardRows) > 0 {
+		db.log.Printf("Upserting %d awards\n", len(showAwardRows))
+		err = db.execRows("upsertShowAward", showAwardRows)
 		if err != nil {
-			db.log.Println(qryUpsertShowAward)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(showDirectorValues) > 0 {
-		db.log.Printf("Inserting %d directors\n", len(showDirectorValues))
-		qryInsertShowDirector := fmt.Sprintf(templates["insertShowDirector"], strings.Join(showDirectorValues, ","))
-		_, err = db.database.Exec(qryInsertShowDirector)
+	if len(showDirectorRows) > 0 {
+		db.log.Printf("Inserting %d directors\n", len(showDirectorRows))
+		err = db.execRows("insertShowDirector", showDirectorRows)
 		if err != nil {
-			db.log.Println(qryInsertShowDirector)
-			db.log.Println(err)
 			return err
 		}
 	}
@@ -569,11 +605,8 @@ func (db *TabloDB) UpsertShows(shows map[string]tabloapi.Show) error {
 
 func (db *TabloDB) DeleteQueueRecord(i int) error {
 	db.log.Printf("deleting queueid %d\n", i)
-	qry := fmt.Sprintf(templates["deleteQueueRecord"], i)
-	_, err := db.database.Exec(qry)
+	err := db.exec("deleteQueueRecord", i)
 	if err != nil {
-		db.log.Println(qry)
-		db.log.Println(err)
 		return err
 	}
 	db.log.Println("queue record deleted")
@@ -583,18 +616,18 @@ func (db *TabloDB) DeleteQueueRecord(i int) error {
 func (db *TabloDB) UpsertAirings(airings map[string]tabloapi.Airing) error {
 	db.log.Printf("preparing %d airings to insert\n", len(airings))
 
-	var airingValues []string
-	var teamValues []string
-	var episodeValues []string
-	var episodeTeamValues []string
+	var airingRows [][]any
+	var teamRows [][]any
+	var episodeRows [][]any
+	var episodeTeamRows [][]any
 
 	for _, a := range airings {
 		if a.ObjectID == 0 {
 			continue
 		}
 
-		var showID string
-		var episodeID string
+		var showID int
+		var episodeID any
 		airdate, err := dateStringToInt(a.AiringDetails.Datetime)
 		if err != nil {
 			db.log.Println(err)
@@ -602,174 +635,87 @@ func (db *TabloDB) UpsertAirings(airings map[string]tabloapi.Airing) error {
 		}
 
 		if a.SeriesPath != "" {
-			showID = strings.Split(a.SeriesPath, "/")[3]
-
-			episodeID = "'" + stringmanip.SanitizeSql(getEpisodeID(showID, strconv.Itoa(a.Episode.SeasonNumber), a.Episode.Number, airdate)) + "'"
-
-			title := "null"
-			if a.Episode.Title != "" {
-				title = "'" + stringmanip.SanitizeSql(a.Episode.Title) + "'"
+			showID, err = pathID(a.SeriesPath)
+			if err != nil {
+				db.log.Println(err)
+				return err
 			}
 
-			description := "null"
-			if a.Episode.Description != "" {
-				description = "'" + stringmanip.SanitizeSql(a.Episode.Description) + "'"
-			}
+			episodeID = getEpisodeID(strconv.Itoa(showID), strconv.Itoa(a.Episode.SeasonNumber), a.Episode.Number, airdate)
 
-			originalAirDate := "null"
+			var originalAirDate any
 			if a.Episode.OrigAirDate != nil {
 				dateInt, err := dateStringToInt(*a.Episode.OrigAirDate)
 				if err != nil {
 					db.log.Println(err)
 					return err
 				}
-				originalAirDate = strconv.Itoa(dateInt)
+				originalAirDate = dateInt
 			}
 
-			var episodeValue strings.Builder
-			episodeValue.WriteRune('(')
-			episodeValue.WriteString(episodeID) // Previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(stringmanip.SanitizeSql(showID))
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(title) // Previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(description) // Previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(strconv.Itoa(a.Episode.Number))
-			episodeValue.WriteString(",'")
-			episodeValue.WriteString(strconv.Itoa(a.Episode.SeasonNumber))
-			episodeValue.WriteString("',null,")
-			episodeValue.WriteString(originalAirDate) // Int value, no sanitization needed
-			episodeValue.WriteString(",null)")
-			episodeValues = append(episodeValues, episodeValue.String())
+			episodeRows = append(episodeRows, []any{episodeID, showID, emptyToNull(a.Episode.Title), emptyToNull(a.Episode.Description), a.Episode.Number, strconv.Itoa(a.Episode.SeasonNumber), nil, originalAirDate, nil})
 		} else if a.MoviePath != "" {
-			showID = strings.Split(a.MoviePath, "/")[3]
-			episodeID = "null"
-		} else if a.SportPath != "" {
-			showID = strings.Split(a.SportPath, "/")[3]
-			episodeID = "'" + stringmanip.SanitizeSql(getEpisodeID(showID, a.Event.Season, 0, airdate)) + "'"
-
-			for _, t := range a.Event.Teams {
-				var teamValue strings.Builder
-				teamValue.WriteRune('(')
-				teamValue.WriteString(strconv.Itoa(t.TeamID))
-				teamValue.WriteString(",'")
-				teamValue.WriteString(stringmanip.SanitizeSql(t.Name))
-				teamValue.WriteString("')")
-				teamValues = append(teamValues, teamValue.String())
-
-				var episodeTeamValue strings.Builder
-				episodeTeamValue.WriteRune('(')
-				episodeTeamValue.WriteString(episodeID)
-				episodeTeamValue.WriteRune(',')
-				episodeTeamValue.WriteString(strconv.Itoa(t.TeamID))
-				episodeTeamValue.WriteRune(')')
-				episodeTeamValues = append(episodeTeamValues, episodeTeamValue.String())
+			showID, err = pathID(a.MoviePath)
+			if err != nil {
+				db.log.Println(err)
+				return err
 			}
-
-			season := "null"
-			if a.Event.Season != "" {
-				season = "'" + stringmanip.SanitizeSql(a.Event.Season) + "'"
-			}
-
-			seasonType := "null"
-			if a.Event.SeasonType != "" {
-				seasonType = "'" + stringmanip.SanitizeSql(a.Event.SeasonType) + "'"
+		} else if a.SportPath != "" {
+			showID, err = pathID(a.SportPath)
+			if err != nil {
+				db.log.Println(err)
+				return err
 			}
+			episodeID = getEpisodeID(strconv.Itoa(showID), a.Event.Season, 0, airdate)
 
-			homeTeamID := "null"
-			if a.Event.HomeTeamID != nil {
-				homeTeamID = strconv.Itoa(*a.Event.HomeTeamID)
+			for _, t := range a.Event.Teams {
+				teamRows = append(teamRows, []any{t.TeamID, t.Name})
+				episodeTeamRows = append(episodeTeamRows, []any{episodeID, t.TeamID})
 			}
 
-			var episodeValue strings.Builder
-			episodeValue.WriteRune('(')
-			episodeValue.WriteString(episodeID)
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(stringmanip.SanitizeSql(showID))
-			episodeValue.WriteString(",'")
-			episodeValue.WriteString(stringmanip.SanitizeSql(a.Event.Title))
-			episodeValue.WriteString("','")
-			episodeValue.WriteString(stringmanip.SanitizeSql(a.Event.Description))
-			episodeValue.WriteString("',null,")
-			episodeValue.WriteString(season) // previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(seasonType) // previously sanitized
-			episodeValue.WriteString(",null,")
-			episodeValue.WriteString(homeTeamID) // Int value, no sanitization required
-			episodeValue.WriteRune(')')
-			episodeValues = append(episodeValues, episodeValue.String())
+			episodeRows = append(episodeRows, []any{episodeID, showID, a.Event.Title, a.Event.Description, nil, emptyToNull(a.Event.Season), emptyToNull(a.Event.SeasonType), nil, a.Event.HomeTeamID})
 		} else {
 			err := fmt.Errorf("No show path for %d", a.ObjectID)
 			db.log.Println(err)
 			return err
 		}
 
-		var airingValue strings.Builder
-		airingValue.WriteRune('(')
-		airingValue.WriteString(strconv.Itoa(a.ObjectID))
-		airingValue.WriteRune(',')
-		airingValue.WriteString(stringmanip.SanitizeSql(showID))
-		airingValue.WriteRune(',')
-		airingValue.WriteString(strconv.Itoa(airdate))
-		airingValue.WriteRune(',')
-		airingValue.WriteString(strconv.Itoa(a.AiringDetails.Duration))
-		airingValue.WriteRune(',')
-		airingValue.WriteString(strconv.Itoa(a.AiringDetails.Channel.ObjectID))
-		airingValue.WriteString(",'")
-		airingValue.WriteString(stringmanip.SanitizeSql(a.Schedule.State))
-		airingValue.WriteString("',")
-		airingValue.WriteString(episodeID) // previously sanitized
-		airingValue.WriteRune(')')
-		airingValues = append(airingValues, airingValue.String())
-	}
-
-	if len(airingValues) == 0 {
-		err := fmt.Errorf("no airings in upsert values")
+		airingRows = append(airingRows, []any{a.ObjectID, showID, airdate, a.AiringDetails.Duration, a.AiringDetails.Channel.ObjectID, a.Schedule.State, episodeID})
+	}
+
+	if len(airingRows) == 0 {
+		err := fmt.Errorf("no airings in upsert values: %w", ErrEmptyResult)
 		fmt.Println(err)
 		return err
 	}
 
-	if len(teamValues) > 0 {
-		db.log.Printf("inserting %d teams\n", len(teamValues))
-		qryUpsertTeam := fmt.Sprintf(templates["upsertTeam"], strings.Join(teamValues, ","))
-		_, err := db.database.Exec(qryUpsertTeam)
+	if len(teamRows) > 0 {
+		db.log.Printf("inserting %d teams\n", len(teamRows))
+		err := db.execRows("upsertTeam", teamRows)
 		if err != nil {
-			db.log.Println(qryUpsertTeam)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(episodeValues) > 0 {
-		db.log.Printf("inserting %d episodes\n", len(episodeValues))
-		qryUpsertEpisode := fmt.Sprintf(templates["upsertEpisode"], strings.Join(episodeValues, ","))
-		_, err := db.database.Exec(qryUpsertEpisode)
+	if len(episodeRows) > 0 {
+		db.log.Printf("inserting %d episodes\n", len(episodeRows))
+		err := db.execRows("upsertEpisode", episodeRows)
 		if err != nil {
-			db.log.Println(qryUpsertEpisode)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(episodeTeamValues) > 0 {
-		db.log.Printf("inserting %d episode teams\n", len(episodeTeamValues))
-		qryInsertEpisodeTeam := fmt.Sprintf(templates["insertEpisodeTeam"], strings.Join(episodeTeamValues, ","))
-		_, err := db.database.Exec(qryInsertEpisodeTeam)
+	if len(episodeTeamRows) > 0 {
+		db.log.Printf("inserting %d episode teams\n", len(episodeTeamRows))
+		err := db.execRows("insertEpisodeTeam", episodeTeamRows)
 		if err != nil {
-			db.log.Println(qryInsertEpisodeTeam)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	db.log.Printf("inserting %d airings\n", len(airingValues))
-	qryUpsertAiring := fmt.Sprintf(templates["upsertAiring"], strings.Join(airingValues, ","))
-	_, err := db.database.Exec(qryUpsertAiring)
+	db.log.Printf("inserting %d airings\n", len(airingRows))
+	err := db.execRows("upsertAiring", airingRows)
 	if err != nil {
-		db.log.Println(qryUpsertAiring)
-		db.log.Println(err)
 		return err
 	}
 
@@ -779,11 +725,8 @@ func (db *TabloDB) UpsertAirings(airings map[string]tabloapi.Airing) error {
 
 func (db *TabloDB) UpdateGuideLastUpdated(guideLastUpdated time.Time) error {
 	dateInt := int(guideLastUpdated.Unix())
-	qryUpdateGuideLastUpdated := fmt.Sprintf(templates["updateGuideLastUpdated"], dateInt)
-	_, err := db.database.Exec(qryUpdateGuideLastUpdated)
+	err := db.exec("updateGuideLastUpdated", dateInt)
 	if err != nil {
-		db.log.Println(qryUpdateGuideLastUpdated)
-		db.log.Println(err)
 		return err
 	}
 	return nil
@@ -791,11 +734,8 @@ func (db *TabloDB) UpdateGuideLastUpdated(guideLastUpdated time.Time) error {
 
 func (db *TabloDB) UpdateScheduledLastUpdated(scheduledLastUpdated time.Time) error {
 	dateInt := int(scheduledLastUpdated.Unix())
-	qryUpdateScheduledLastUpdated := fmt.Sprintf(templates["updateScheduledLastUpdated"], dateInt)
-	_, err := db.database.Exec(qryUpdateScheduledLastUpdated)
+	err := db.exec("updateScheduledLastUpdated", dateInt)
 	if err != nil {
-		db.log.Println(qryUpdateScheduledLastUpdated)
-		db.log.Println(err)
 		return err
 	}
 	return nil
@@ -803,11 +743,8 @@ func (db *TabloDB) UpdateScheduledLastUpdated(scheduledLastUpdated time.Time) er
 
 func (db *TabloDB) UpdateRecordingsLastUpdated(recordingsLastUpdated time.Time) error {
 	dateInt := int(recordingsLastUpdated.Unix())
-	qryUpdateRecordingsLastUpdated := fmt.Sprintf(templates["updateRecordingsLastUpdated"], dateInt)
-	_, err := db.database.Exec(qryUpdateRecordingsLastUpdated)
+	err := db.exec("updateRecordingsLastUpdated", dateInt)
 	if err != nil {
-		db.log.Println(qryUpdateRecordingsLastUpdated)
-		db.log.Println(err)
 		return err
 	}
 	return nil
@@ -816,20 +753,19 @@ func (db *TabloDB) UpdateRecordingsLastUpdated(recordingsLastUpdated time.Time)
 func (db *TabloDB) UpsertRecordings(recordings map[string]tabloapi.Recording) error {
 	db.log.Printf("preparing %d recording airings to insert\n", len(recordings))
 
-	var recordingValues []string
-	var teamValues []string
-	var episodeValues []string
-	var episodeTeamValues []string
-	var errorValues []string
-	var recordingIDs []string
+	var recordingRows [][]any
+	var teamRows [][]any
+	var episodeRows [][]any
+	var episodeTeamRows [][]any
+	var errorRows [][]any
 
 	for _, r := range recordings {
 		if r.ObjectID == 0 {
 			continue
 		}
 
-		var showID string
-		var episodeID string
+		var showID int
+		var episodeID any
 		airdate, err := dateStringToInt(r.AiringDetails.Datetime)
 		if err != nil {
 			db.log.Println(err)
@@ -837,269 +773,167 @@ func (db *TabloDB) UpsertRecordings(recordings map[string]tabloapi.Recording) er
 		}
 
 		if r.SeriesPath != "" {
-			showID = "-" + strings.Split(r.SeriesPath, "/")[3]
-
-			episodeID = "'" + stringmanip.SanitizeSql(getEpisodeID(showID, strconv.Itoa(r.Episode.SeasonNumber), r.Episode.Number, airdate)) + "'"
-
-			title := "null"
-			if r.Episode.Title != "" {
-				title = "'" + stringmanip.SanitizeSql(r.Episode.Title) + "'"
+			showID, err = pathID(r.SeriesPath)
+			if err != nil {
+				db.log.Println(err)
+				return err
 			}
+			showID = -showID
 
-			description := "null"
-			if r.Episode.Description != "" {
-				description = "'" + stringmanip.SanitizeSql(r.Episode.Description) + "'"
-			}
+			episodeID = getEpisodeID(strconv.Itoa(showID), strconv.Itoa(r.Episode.SeasonNumber), r.Episode.Number, airdate)
 
-			originalAirDate := "null"
+			var originalAirDate any
 			if r.Episode.OrigAirDate != nil {
 				dateInt, err := dateStringToInt(*r.Episode.OrigAirDate)
 				if err != nil {
 					db.log.Println(err)
 					return err
 				}
-				originalAirDate = strconv.Itoa(dateInt)
+				originalAirDate = dateInt
 			}
 
-			var episodeValue strings.Builder
-			episodeValue.WriteRune('(')
-			episodeValue.WriteString(episodeID) // Previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(stringmanip.SanitizeSql(showID))
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(title) // Previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(description) // Previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(strconv.Itoa(r.Episode.Number))
-			episodeValue.WriteString(",'")
-			episodeValue.WriteString(strconv.Itoa(r.Episode.SeasonNumber))
-			episodeValue.WriteString("',null,")
-			episodeValue.WriteString(originalAirDate) // Int value, no sanitization needed
-			episodeValue.WriteString(",null)")
-			episodeValues = append(episodeValues, episodeValue.String())
+			episodeRows = append(episodeRows, []any{episodeID, showID, emptyToNull(r.Episode.Title), emptyToNull(r.Episode.Description), r.Episode.Number, strconv.Itoa(r.Episode.SeasonNumber), nil, originalAirDate, nil})
 		} else if r.MoviePath != "" {
-			showID = "-" + strings.Split(r.MoviePath, "/")[3]
-			episodeID = "null"
-		} else if r.SportPath != "" {
-			showID = "-" + strings.Split(r.SportPath, "/")[3]
-			episodeID = "'" + stringmanip.SanitizeSql(getEpisodeID(showID, r.Event.Season, 0, airdate)) + "'"
-
-			for _, t := range r.Event.Teams {
-				var teamValue strings.Builder
-				teamValue.WriteRune('(')
-				teamValue.WriteString(strconv.Itoa(t.TeamID))
-				teamValue.WriteString(",'")
-				teamValue.WriteString(stringmanip.SanitizeSql(t.Name))
-				teamValue.WriteString("')")
-				teamValues = append(teamValues, teamValue.String())
-
-				var episodeTeamValue strings.Builder
-				episodeTeamValue.WriteRune('(')
-				episodeTeamValue.WriteString(episodeID)
-				episodeTeamValue.WriteRune(',')
-				episodeTeamValue.WriteString(strconv.Itoa(t.TeamID))
-				episodeTeamValue.WriteRune(')')
-				episodeTeamValues = append(episodeTeamValues, episodeTeamValue.String())
+			showID, err = pathID(r.MoviePath)
+			if err != nil {
+				db.log.Println(err)
+				return err
 			}
-
-			season := "null"
-			if r.Event.Season != "" {
-				season = "'" + stringmanip.SanitizeSql(r.Event.Season) + "'"
-			}
-
-			seasonType := "null"
-			if r.Event.SeasonType != "" {
-				seasonType = "'" + stringmanip.SanitizeSql(r.Event.SeasonType) + "'"
+			showID = -showID
+		} else if r.SportPath != "" {
+			showID, err = pathID(r.SportPath)
+			if err != nil {
+				db.log.Println(err)
+				return err
 			}
+			showID = -showID
+			episodeID = getEpisodeID(strconv.Itoa(showID), r.Event.Season, 0, airdate)
 
-			homeTeamID := "null"
-			if r.Event.HomeTeamID != nil {
-				homeTeamID = strconv.Itoa(*r.Event.HomeTeamID)
+			for _, t := range r.Event.Teams {
+				teamRows = append(teamRows, []any{t.TeamID, t.Name})
+				episodeTeamRows = append(episodeTeamRows, []any{episodeID, t.TeamID})
 			}
 
-			var episodeValue strings.Builder
-			episodeValue.WriteRune('(')
-			episodeValue.WriteString(episodeID)
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(stringmanip.SanitizeSql(showID))
-			episodeValue.WriteString(",'")
-			episodeValue.WriteString(stringmanip.SanitizeSql(r.Event.Title))
-			episodeValue.WriteString("','")
-			episodeValue.WriteString(stringmanip.SanitizeSql(r.Event.Description))
-			episodeValue.WriteString("',null,")
-			episodeValue.WriteString(season) // previously sanitized
-			episodeValue.WriteRune(',')
-			episodeValue.WriteString(seasonType) // previously sanitized
-			episodeValue.WriteString(",null,")
-			episodeValue.WriteString(homeTeamID) // Int value, no sanitization required
-			episodeValue.WriteRune(')')
-			episodeValues = append(episodeValues, episodeValue.String())
+			episodeRows = append(episodeRows, []any{episodeID, showID, r.Event.Title, r.Event.Description, nil, emptyToNull(r.Event.Season), emptyToNull(r.Event.SeasonType), nil, r.Event.HomeTeamID})
 		} else {
 			err := fmt.Errorf("No show path for %d", r.ObjectID)
 			db.log.Println(err)
 			return err
 		}
 
-		clean := "0"
-		if r.VideoDetails.Clean {
-			clean = "1"
-		}
-
-		var recordingValue strings.Builder
-		recordingValue.WriteRune('(')
-		recordingValue.WriteString(strconv.Itoa(r.ObjectID))
-		recordingValue.WriteRune(',')
-		recordingValue.WriteString(stringmanip.SanitizeSql(showID))
-		recordingValue.WriteRune(',')
-		recordingValue.WriteString(strconv.Itoa(airdate))
-		recordingValue.WriteRune(',')
-		recordingValue.WriteString(strconv.Itoa(r.AiringDetails.Duration))
-		recordingValue.WriteRune(',')
-		recordingValue.WriteString("-" + strconv.Itoa(r.AiringDetails.Channel.ObjectID))
-		recordingValue.WriteString(",'")
-		recordingValue.WriteString(stringmanip.SanitizeSql(r.VideoDetails.State))
-		recordingValue.WriteString("',")
-		recordingValue.WriteString(clean) // Bool value, no sanitization needed
-		recordingValue.WriteRune(',')
-		recordingValue.WriteString(strconv.Itoa(r.VideoDetails.Duration))
-		recordingValue.WriteRune(',')
-		recordingValue.WriteString(strconv.Itoa(r.VideoDetails.Size))
-		recordingValue.WriteString(",'")
-		recordingValue.WriteString(stringmanip.SanitizeSql(r.VideoDetails.ComSkip.State))
-		recordingValue.WriteString("',")
-		recordingValue.WriteString(episodeID) // previously sanitized
-		recordingValue.WriteRune(')')
-		recordingValues = append(recordingValues, recordingValue.String())
-
-		recordingIDs = append(recordingIDs, strconv.Itoa(r.ObjectID))
+		recordingRows = append(recordingRows, []any{r.ObjectID, showID, airdate, r.AiringDetails.Duration, -r.AiringDetails.Channel.ObjectID, r.VideoDetails.State, r.VideoDetails.Clean, r.VideoDetails.Duration, r.VideoDetails.Size, r.VideoDetails.ComSkip.State, episodeID})
 
 		if r.VideoDetails.State == "failed" || !r.VideoDetails.Clean || r.VideoDetails.ComSkip.State != "none" {
-			var comSkipError = "null"
-			if r.VideoDetails.ComSkip.Error != nil {
-				comSkipError = "'" + stringmanip.SanitizeSql(*r.VideoDetails.ComSkip.Error) + "'"
-			}
-
-			var errorCode = "null"
-			if r.VideoDetails.Error.Code != nil {
-				comSkipError = "'" + stringmanip.SanitizeSql(*r.VideoDetails.Error.Code) + "'"
-			}
-
-			var errorDetails = "null"
-			if r.VideoDetails.Error.Details != nil {
-				comSkipError = "'" + stringmanip.SanitizeSql(*r.VideoDetails.Error.Details) + "'"
-			}
-
-			var errorDescription = "null"
-			if r.VideoDetails.Error.Description != nil {
-				comSkipError = "'" + stringmanip.SanitizeSql(*r.VideoDetails.Error.Description) + "'"
-			}
-
-			var errorValue strings.Builder
-			errorValue.WriteRune('(')
-			errorValue.WriteString(strconv.Itoa(r.ObjectID))
-			errorValue.WriteRune(',')
-			errorValue.WriteString(stringmanip.SanitizeSql(showID))
-			errorValue.WriteRune(',')
-			errorValue.WriteString(episodeID) // previously sanitized
-			errorValue.WriteRune(',')
-			errorValue.WriteString(strconv.Itoa(r.AiringDetails.Channel.ObjectID))
-			errorValue.WriteRune(',')
-			errorValue.WriteString(strconv.Itoa(airdate))
-			errorValue.WriteRune(',')
-			errorValue.WriteString(strconv.Itoa(r.AiringDetails.Duration))
-			errorValue.WriteRune(',')
-			errorValue.WriteString(strconv.Itoa(r.VideoDetails.Duration))
-			errorValue.WriteRune(',')
-			errorValue.WriteString(strconv.Itoa(r.VideoDetails.Size))
-			errorValue.WriteString(",'")
-			errorValue.WriteString(stringmanip.SanitizeSql(r.VideoDetails.State))
-			errorValue.WriteString("',")
-			errorValue.WriteString(clean) // Bool value. No sanitization needed
-			errorValue.WriteString(",'")
-			errorValue.WriteString(stringmanip.SanitizeSql(r.VideoDetails.ComSkip.State))
-			errorValue.WriteString("',")
-			errorValue.WriteString(comSkipError) // previously sanitized
-			errorValue.WriteRune(',')
-			errorValue.WriteString(errorCode) // previously sanitized
-			errorValue.WriteRune(',')
-			errorValue.WriteString(errorDetails) // previously sanitized
-			errorValue.WriteRune(',')
-			errorValue.WriteString(errorDescription) // previously sanitized
-			errorValue.WriteRune(')')
-			errorValues = append(errorValues, errorValue.String())
+			errorRows = append(errorRows, []any{r.ObjectID, showID, episodeID, r.AiringDetails.Channel.ObjectID, airdate, r.AiringDetails.Duration, r.VideoDetails.Duration, r.VideoDetails.Size, r.VideoDetails.State, r.VideoDetails.Clean, r.VideoDetails.ComSkip.State, r.VideoDetails.ComSkip.Error, r.VideoDetails.Error.Code, r.VideoDetails.Error.Details, r.VideoDetails.Error.Description})
 		}
 	}
 
-	if len(recordingValues) == 0 {
-		err := fmt.Errorf("no recording airings in upsert values")
+	if len(recordingRows) == 0 {
+		err := fmt.Errorf("no recording airings in upsert values: %w", ErrEmptyResult)
 		fmt.Println(err)
 		return err
 	}
 
-	if len(teamValues) > 0 {
-		db.log.Printf("inserting %d teams\n", len(teamValues))
-		qryUpsertTeam := fmt.Sprintf(templates["upsertTeam"], strings.Join(teamValues, ","))
-		_, err := db.database.Exec(qryUpsertTeam)
+	if len(teamRows) > 0 {
+		db.log.Printf("inserting %d teams\n", len(teamRows))
+		err := db.execRows("upsertTeam", teamRows)
 		if err != nil {
-			db.log.Println(qryUpsertTeam)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(episodeValues) > 0 {
-		db.log.Printf("inserting %d episodes\n", len(episodeValues))
-		qryUpsertEpisode := fmt.Sprintf(templates["upsertEpisode"], strings.Join(episodeValues, ","))
-		_, err := db.database.Exec(qryUpsertEpisode)
+	if len(episodeRows) > 0 {
+		db.log.Printf("inserting %d episodes\n", len(episodeRows))
+		err := db.execRows("upsertEpisode", episodeRows)
 		if err != nil {
-			db.log.Println(qryUpsertEpisode)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(episodeTeamValues) > 0 {
-		db.log.Printf("inserting %d episode teams\n", len(episodeTeamValues))
-		qryInsertEpisodeTeam := fmt.Sprintf(templates["insertEpisodeTeam"], strings.Join(episodeTeamValues, ","))
-		_, err := db.database.Exec(qryInsertEpisodeTeam)
+	if len(episodeTeamRows) > 0 {
+		db.log.Printf("inserting %d episode teams\n", len(episodeTeamRows))
+		err := db.execRows("insertEpisodeTeam", episodeTeamRows)
 		if err != nil {
-			db.log.Println(qryInsertEpisodeTeam)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	if len(errorValues) > 0 {
-		db.log.Printf("inserting %d errors\n", len(errorValues))
-		qryInsertErrors := fmt.Sprintf(templates["insertError"], strings.Join(errorValues, ","))
-		_, err := db.database.Exec(qryInsertErrors)
+	if len(errorRows) > 0 {
+		db.log.Printf("inserting %d errors\n", len(errorRows))
+		err := db.execRows("insertError", errorRows)
 		if err != nil {
-			db.log.Println(qryInsertErrors)
-			db.log.Println(err)
 			return err
 		}
 	}
 
-	db.log.Printf("inserting %d recording airings\n", len(recordingValues))
-	qryUpsertRecording := fmt.Sprintf(templates["upsertRecording"], strings.Join(recordingValues, ","))
-	_, err := db.database.Exec(qryUpsertRecording)
+	db.log.Printf("inserting %d recording airings\n", len(recordingRows))
+	err := db.execRows("upsertRecording", recordingRows)
 	if err != nil {
-		db.log.Println(qryUpsertRecording)
+		return err
+	}
+
+	db.log.Println("recording airings inserted")
+	return nil
+}
+
+// DeleteRemovedRecordings deletes every recording that is not in recordingIDs,
+// the full list of recordings still on the Tablo
+func (db *TabloDB) DeleteRemovedRecordings(recordingIDs []int) error {
+	if len(recordingIDs) == 0 {
+		err := fmt.Errorf("no recordings in delete values: %w", ErrEmptyResult)
 		db.log.Println(err)
 		return err
 	}
 
 	db.log.Println("purging deleted recordings")
-	qryDeleteRemovedRecordings := fmt.Sprintf(templates["deleteRemovedRecordings"], strings.Join(recordingIDs, "),("))
-	_, err = db.database.Exec(qryDeleteRemovedRecordings)
+
+	// tempRecordingID is a temp table, so only exists on the transaction's
+	// connection
+	tx, err := db.database.Begin()
+	if err != nil {
+		db.log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(queries["createTempRecordingID"])
+	if err != nil {
+		db.log.Println(queries["createTempRecordingID"])
+		db.log.Println(err)
+		return err
+	}
+
+	insert, err := tx.Prepare(statements["insertTempRecordingID"])
+	if err != nil {
+		db.log.Println(statements["insertTempRecordingID"])
+		db.log.Println(err)
+		return err
+	}
+	defer insert.Close()
+
+	for _, r := range recordingIDs {
+		_, err = insert.Exec(r)
+		if err != nil {
+			db.log.Println(statements["insertTempRecordingID"])
+			db.log.Println(r)
+			db.log.Println(err)
+			return err
+		}
+	}
+
+	_, err = tx.Exec(queries["deleteRemovedRecordings"])
+	if err != nil {
+		db.log.Println(queries["deleteRemovedRecordings"])
+		db.log.Println(err)
+		return err
+	}
+
+	err = tx.Commit()
 	if err != nil {
-		db.log.Println(qryDeleteRemovedRecordings)
 		db.log.Println(err)
 		return err
 	}
 
-	db.log.Println("recording airings inserted")
 	return nil
 }
 
@@ -1131,6 +965,21 @@ func (db *TabloDB) GetDefaultExportPath() (string, error) {
 	return defaultExportPath, nil
 }
 
+// GetSystemInfo returns the serverID, name and privateIP saved in the cache
+func (db *TabloDB) GetSystemInfo() (string, string, string, error) {
+	row := db.database.QueryRow(queries["getSystemInfo"])
+
+	var serverID, name, privateIP string
+	err := row.Scan(&serverID, &name, &privateIP)
+	if err != nil {
+		db.log.Println(queries["getSystemInfo"])
+		db.log.Println(err)
+		return "", "", "", err
+	}
+
+	return serverID, name, privateIP, nil
+}
+
 func (db *TabloDB) getVersion() (int, error) {
 	row := db.database.QueryRow(queries["getDBVer"])
 
@@ -1146,18 +995,35 @@ func (db *TabloDB) getVersion() (int, error) {
 }
 
 func (db *TabloDB) updateVer(currentVer int) error {
-	// TODO: Implement version upgrading if the database structure is changed
-	db.log.Printf("currentVer: %d\n", currentVer)
-	db.log.Println("not yet implemented")
+	db.log.Printf("upgrading database from version %d to %d\n", currentVer, dbVer)
+
+	for ver := currentVer + 1; ver <= dbVer; ver++ {
+		db.log.Printf("applying version %d upgrade\n", ver)
+		_, err := db.database.Exec(upgrades[ver])
+		if err != nil {
+			db.log.Println(upgrades[ver])
+			db.log.Println(err)
+			return err
+		}
+	}
+
+	db.log.Println("database upgraded")
+	return nil
+}
+
+func (db *TabloDB) UpdatePrivateIP(ipAddress string) error {
+	db.log.Printf("updating privateIP to %s\n", ipAddress)
+	err := db.exec("updatePrivateIP", ipAddress)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (db *TabloDB) UpdateSpace(total int64, free int64) error {
-	qryUpdateSpace := fmt.Sprintf(templates["updateSpace"], total, free)
-	_, err := db.database.Exec(qryUpdateSpace)
+	err := db.exec("updateSpace", total, free)
 	if err != nil {
-		db.log.Println(qryUpdateSpace)
-		db.log.Println(err)
 		return err
 	}
 
@@ -1220,34 +1086,29 @@ func (db *TabloDB) UpdateConflicts() error {
 		scheduled = append(scheduled, schedule)
 	}
 
-	var conflictValues []string
+	var conflictValues [][]any
 	for _, c := range conflicts {
-		conflictValue := createConflictValue(c)
-		conflictValues = append(conflictValues, conflictValue)
+		conflictValues = append(conflictValues, conflictRow(c))
 		for i, s := range scheduled {
 			if s == nil {
 				continue
 			}
 
 			if isOverlapping(c, *s) {
-				conflictValue := createConflictValue(*s)
-				conflictValues = append(conflictValues, conflictValue)
+				conflictValues = append(conflictValues, conflictRow(*s))
 				scheduled[i] = nil
 			}
 		}
 	}
 
 	if len(conflictValues) == 0 {
-		err = fmt.Errorf("no conflicts in insert values")
+		err = fmt.Errorf("no conflicts in insert values: %w", ErrEmptyResult)
 		fmt.Println(err)
 		return err
 	}
 
-	qryInsertConflicts := fmt.Sprintf(templates["insertConflicts"], strings.Join(conflictValues, ","))
-	_, err = db.database.Exec(qryInsertConflicts)
+	err = db.execRows("insertConflicts", conflictValues)
 	if err != nil {
-		fmt.Println(qryInsertConflicts)
-		fmt.Println(err)
 		return err
 	}
 
@@ -1282,19 +1143,46 @@ func (db *TabloDB) GetExported() ([]string, error) {
 	return exported, nil
 }
 
+// GetExportedRecordingIDs returns the IDs of the recordings that have been
+// exported, whatever path they were exported to
+func (db *TabloDB) GetExportedRecordingIDs() ([]int, error) {
+	db.log.Println("selecting exported recording ids")
+
+	rows, err := db.database.Query(queries["selectExportedRecordingIDs"])
+	if err != nil {
+		db.log.Println(queries["selectExportedRecordingIDs"])
+		db.log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var recordingIDs []int
+	for rows.Next() {
+		var recordingID int
+		err = rows.Scan(&recordingID)
+		if err != nil {
+			db.log.Println(err)
+			return nil, err
+		}
+
+		recordingIDs = append(recordingIDs, recordingID)
+	}
+
+	db.log.Printf("%d exported recording ids selected\n", len(recordingIDs))
+	return recordingIDs, nil
+}
+
 func (db *TabloDB) DeleteExported(toDelete []string) error {
 	db.log.Printf("removing %d missing exports\n", len(toDelete))
 
-	var sanitizedToDelete []string
+	var rows [][]any
 	for _, v := range toDelete {
-		sanitizedToDelete = append(sanitizedToDelete, stringmanip.SanitizeSql(v))
+		rows = append(rows, []any{v})
 	}
 
-	qryDeleteExported := fmt.Sprintf(templates["deleteExported"], strings.Join(sanitizedToDelete, "','"))
-	_, err := db.database.Exec(qryDeleteExported)
+	err := db.execRows("deleteExported", rows)
 	if err != nil {
-		db.log.Println(qryDeleteExported)
-		db.log.Println(err)
 		return err
 	}
 
@@ -1305,16 +1193,13 @@ func (db *TabloDB) DeleteExported(toDelete []string) error {
 func (db *TabloDB) InsertExported(toInsert []string) error {
 	db.log.Printf("inserting %d exported values\n", len(toInsert))
 
-	var sanitizedToInsert []string
+	var rows [][]any
 	for _, v := range toInsert {
-		sanitizedToInsert = append(sanitizedToInsert, stringmanip.SanitizeSql(v))
+		rows = append(rows, []any{v})
 	}
 
-	qryInsertExported := fmt.Sprintf(templates["insertExported"], strings.Join(sanitizedToInsert, "'),('"))
-	_, err := db.database.Exec(qryInsertExported)
+	err := db.execRows("insertExported", rows)
 	if err != nil {
-		db.log.Println(qryInsertExported)
-		db.log.Println(err)
 		return err
 	}
 
@@ -1322,68 +1207,524 @@ func (db *TabloDB) InsertExported(toInsert []string) error {
 	return nil
 }
 
-func (db *TabloDB) GetScheduledAirings() ([]ScheduledAiringRecord, error) {
-	db.log.Println("getting all scheduled airings")
+func (db *TabloDB) GetSuspectExported() ([]string, error) {
+	db.log.Println("selecting suspect exported values")
 
-	rows, err := db.database.Query(queries["selectScheduledAirings"])
+	rows, err := db.database.Query(queries["selectSuspectExported"])
 	if err != nil {
+		db.log.Println(queries["selectSuspectExported"])
 		db.log.Println(err)
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var airings []ScheduledAiringRecord
+	var suspect []string
 	for rows.Next() {
-		var airing ScheduledAiringRecord
-		err = rows.Scan(&airing.AiringID, &airing.ShowType, &airing.ShowTitle, &airing.Season, &airing.Episode, &airing.AirDate, &airing.EpisodeTitle, &airing.ReleaseYear)
+		var export string
+		err = rows.Scan(&export)
 		if err != nil {
 			db.log.Println(err)
 			return nil, err
 		}
 
-		releaseDate := time.Unix(int64(airing.ReleaseYear), 0)
-		airing.ReleaseYear = releaseDate.Year()
-		airings = append(airings, airing)
+		suspect = append(suspect, export)
 	}
 
-	db.log.Printf("%d scheduled airings found\n", len(airings))
-	return airings, nil
+	db.log.Printf("%d suspect exported values selected\n", len(suspect))
+	return suspect, nil
 }
 
-func (db *TabloDB) PurgeExpiredAirings() error {
-	db.log.Println("Deleting expired airings")
-	now := time.Now().Unix()
-	qryDeleteExpiredAirings := fmt.Sprintf(templates["deleteExpiredAirings"], now)
-	_, err := db.database.Exec(qryDeleteExpiredAirings)
+func (db *TabloDB) UpsertExportedVerification(exported ExportedRecord) error {
+	db.log.Printf("marking %s %s\n", exported.FullPath, exported.Verification)
+
+	err := db.exec("upsertExportedVerification", exported.FullPath, exported.RecordingID, exported.Verification, exported.FileSize, exported.FileDuration)
 	if err != nil {
-		db.log.Println(qryDeleteExpiredAirings)
-		db.log.Println(err)
 		return err
 	}
-	db.log.Println("Expired airings deleted")
+
 	return nil
 }
 
-func (db *TabloDB) DeleteAiring(airingID int) error {
-	db.log.Printf("deleting airingID %d\n", airingID)
-	qryDeleteAiringByID := fmt.Sprintf(templates["deleteAiringByID"], strconv.Itoa(airingID))
-	_, err := db.database.Exec(qryDeleteAiringByID)
+func (db *TabloDB) GetVerifyTolerance() (float64, error) {
+	row := db.database.QueryRow(queries["getVerifyTolerance"])
+
+	var verifyTolerance float64
+	err := row.Scan(&verifyTolerance)
 	if err != nil {
-		db.log.Println(qryDeleteAiringByID)
+		db.log.Println(queries["getVerifyTolerance"])
 		db.log.Println(err)
-		return err
+		return 0, err
 	}
 
-	db.log.Println("airing deleted")
-	return err
+	return verifyTolerance, nil
 }
 
-func (db *TabloDB) UpsertSingleAiring(airing tabloapi.Airing) error {
+// GetExportTemplates returns the export filename templates keyed by show type.
+// Show types without a template are left out.
+func (db *TabloDB) GetExportTemplates() (map[string]string, error) {
+	row := db.database.QueryRow(queries["getExportTemplates"])
+
+	var seriesTemplate, movieTemplate, sportTemplate string
+	err := row.Scan(&seriesTemplate, &movieTemplate, &sportTemplate)
+	if err != nil {
+		db.log.Println(queries["getExportTemplates"])
+		db.log.Println(err)
+		return nil, err
+	}
+
+	exportTemplates := make(map[string]string)
+	if seriesTemplate != "" {
+		exportTemplates["series"] = seriesTemplate
+	}
+	if movieTemplate != "" {
+		exportTemplates["movies"] = movieTemplate
+	}
+	if sportTemplate != "" {
+		exportTemplates["sports"] = sportTemplate
+	}
+
+	return exportTemplates, nil
+}
+
+func (db *TabloDB) GetDeleteAfterExport() (bool, error) {
+	row := db.database.QueryRow(queries["getDeleteAfterExport"])
+
+	var deleteAfterExport int
+	err := row.Scan(&deleteAfterExport)
+	if err != nil {
+		db.log.Println(queries["getDeleteAfterExport"])
+		db.log.Println(err)
+		return false, err
+	}
+
+	return deleteAfterExport != 0, nil
+}
+
+func (db *TabloDB) GetExportLimits() (int, int64, error) {
+	row := db.database.QueryRow(queries["getExportLimits"])
+
+	var workers int
+	var bytesPerSecond int64
+	err := row.Scan(&workers, &bytesPerSecond)
+	if err != nil {
+		db.log.Println(queries["getExportLimits"])
+		db.log.Println(err)
+		return 0, 0, err
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	return workers, bytesPerSecond, nil
+}
+
+// GetRequestTimeout returns how long to wait on a Tablo that has stopped
+// responding. 0 means use the default.
+func (db *TabloDB) GetRequestTimeout() (time.Duration, error) {
+	row := db.database.QueryRow(queries["getRequestTimeout"])
+
+	var seconds int
+	err := row.Scan(&seconds)
+	if err != nil {
+		db.log.Println(queries["getRequestTimeout"])
+		db.log.Println(err)
+		return 0, err
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// GetBatchWorkers returns how many batch requests to send to the Tablo at
+// once. 0 means use the default.
+func (db *TabloDB) GetBatchWorkers() (int, error) {
+	row := db.database.QueryRow(queries["getBatchWorkers"])
+
+	var workers int
+	err := row.Scan(&workers)
+	if err != nil {
+		db.log.Println(queries["getBatchWorkers"])
+		db.log.Println(err)
+		return 0, err
+	}
+
+	return workers, nil
+}
+
+func (db *TabloDB) DeleteRecording(recordingID int) error {
+	db.log.Printf("deleting recordingID %d\n", recordingID)
+	err := db.exec("deleteRecordingByID", recordingID)
+	if err != nil {
+		return err
+	}
+
+	db.log.Println("recording deleted")
+	return nil
+}
+
+func (db *TabloDB) InsertDeleteAudit(audit DeleteAuditRecord) error {
+	db.log.Printf("auditing delete of recording %d: %s\n", audit.RecordingID, audit.Result)
+
+	err := db.exec("insertDeleteAudit", audit.RecordingID, audit.ShowID, emptyToNull(audit.EpisodeID), audit.ShowTitle, audit.FullPath, audit.DeletedAt.Unix(), audit.Result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *TabloDB) GetExportHooks(showType string) ([]ExportHookRecord, error) {
+	rows, err := db.query("selectExportHooks", showType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []ExportHookRecord
+	for rows.Next() {
+		var hook ExportHookRecord
+		err = rows.Scan(&hook.HookID, &hook.Command, &hook.OnSuspect)
+		if err != nil {
+			db.log.Println(err)
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		db.log.Println(err)
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+func (db *TabloDB) InsertQueueHistory(history QueueHistoryRecord) error {
+	err := db.exec("insertQueueHistory", history.QueueID, history.Action, history.Details, history.ExportPath, history.Result, history.ExitStatus, history.Output, history.FinishedAt.Unix())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RaiseAlert records a problem that needs someone's attention. Raising an
+// alert that is already open only updates its message.
+func (db *TabloDB) RaiseAlert(alertType string, details string, message string) error {
+	db.log.Printf("raising %s alert: %s\n", alertType, message)
+	err := db.exec("upsertAlert", alertType, details, message, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetOpenAlerts returns the alerts that have not been cleared, oldest first
+func (db *TabloDB) GetOpenAlerts() ([]AlertRecord, error) {
+	db.log.Println("getting open alerts")
+
+	rows, err := db.database.Query(queries["selectOpenAlerts"])
+	if err != nil {
+		db.log.Println(queries["selectOpenAlerts"])
+		db.log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var alerts []AlertRecord
+	for rows.Next() {
+		var alert AlertRecord
+		var raisedAt int64
+		err = rows.Scan(&alert.AlertID, &alert.AlertType, &alert.Details, &alert.Message, &raisedAt)
+		if err != nil {
+			db.log.Println(err)
+			return nil, err
+		}
+
+		alert.RaisedAt = time.Unix(raisedAt, 0)
+		alerts = append(alerts, alert)
+	}
+
+	db.log.Printf("%d open alerts found\n", len(alerts))
+	return alerts, nil
+}
+
+func (db *TabloDB) ClearAlert(alertType string, details string) error {
+	err := db.exec("clearAlert", time.Now().Unix(), alertType, details)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *TabloDB) GetShowMetadata(showID int) (ShowMetadataRecord, error) {
+	db.log.Printf("getting metadata for show %d\n", showID)
+
+	var show ShowMetadataRecord
+	stmt, err := db.stmt("selectShowMetadata")
+	if err != nil {
+		return show, err
+	}
+	err = stmt.QueryRow(showID).Scan(&show.ShowID, &show.ShowType, &show.Title, &show.Description, &show.ReleaseDate, &show.OrigRunTime, &show.Rating)
+	if err != nil {
+		db.log.Println(statements["selectShowMetadata"])
+		db.log.Println(err)
+		return show, notFound(err, fmt.Sprintf("show %d", showID))
+	}
+
+	show.Genres, err = db.selectStrings("selectShowGenres", showID)
+	if err != nil {
+		return show, err
+	}
+
+	show.Cast, err = db.selectStrings("selectShowCastMembers", showID)
+	if err != nil {
+		return show, err
+	}
+
+	show.Directors, err = db.selectStrings("selectShowDirectors", showID)
+	if err != nil {
+		return show, err
+	}
+
+	rows, err := db.query("selectShowAwards", showID)
+	if err != nil {
+		return show, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var award AwardRecord
+		err = rows.Scan(&award.Won, &award.Name, &award.Category, &award.Year, &award.Nominee)
+		if err != nil {
+			db.log.Println(err)
+			return show, err
+		}
+		show.Awards = append(show.Awards, award)
+	}
+
+	return show, nil
+}
+
+func (db *TabloDB) GetEpisodeMetadata(episodeID string) (EpisodeMetadataRecord, error) {
+	db.log.Printf("getting metadata for episode %s\n", episodeID)
+
+	var episode EpisodeMetadataRecord
+	stmt, err := db.stmt("selectEpisodeMetadata")
+	if err != nil {
+		return episode, err
+	}
+	err = stmt.QueryRow(episodeID).Scan(&episode.EpisodeID, &episode.Title, &episode.Description, &episode.Episode, &episode.Season, &episode.OriginalAirDate)
+	if err != nil {
+		db.log.Println(statements["selectEpisodeMetadata"])
+		db.log.Println(err)
+		return episode, notFound(err, "episode "+episodeID)
+	}
+
+	return episode, nil
+}
+
+func (db *TabloDB) selectStrings(name string, args ...any) ([]string, error) {
+	rows, err := db.query(name, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+		if err != nil {
+			db.log.Println(err)
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (db *TabloDB) GetScheduledAirings() ([]ScheduledAiringRecord, error) {
+	db.log.Println("getting all scheduled airings")
+
+	rows, err := db.database.Query(queries["selectScheduledAirings"])
+	if err != nil {
+		db.log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var airings []ScheduledAiringRecord
+	for rows.Next() {
+		var airing ScheduledAiringRecord
+		err = rows.Scan(&airing.AiringID, &airing.ShowType, &airing.ShowTitle, &airing.Season, &airing.Episode, &airing.AirDate, &airing.EpisodeTitle, &airing.ReleaseYear, &airing.OrigAirDate, &airing.CallSign, &airing.Teams)
+		if err != nil {
+			db.log.Println(err)
+			return nil, err
+		}
+
+		releaseDate := time.Unix(int64(airing.ReleaseYear), 0)
+		airing.ReleaseYear = releaseDate.Year()
+		airings = append(airings, airing)
+	}
+
+	db.log.Printf("%d scheduled airings found\n", len(airings))
+	return airings, nil
+}
+
+func (db *TabloDB) GetRecording(recordingID int) (RecordingRecord, error) {
+	db.log.Printf("getting recording %d\n", recordingID)
+
+	var recording RecordingRecord
+	stmt, err := db.stmt("selectRecordingByID")
+	if err != nil {
+		return recording, err
+	}
+	err = stmt.QueryRow(recordingID).Scan(&recording.RecordingID, &recording.ShowType, &recording.ShowTitle, &recording.Season, &recording.Episode, &recording.AirDate, &recording.EpisodeTitle, &recording.ReleaseYear, &recording.RecordingState, &recording.RecordingDuration, &recording.RecordingSize, &recording.ShowID, &recording.EpisodeID, &recording.ComSkipState, &recording.CallSign, &recording.Teams)
+	if err != nil {
+		db.log.Println(statements["selectRecordingByID"])
+		db.log.Println(err)
+		return recording, notFound(err, fmt.Sprintf("recording %d", recordingID))
+	}
+
+	releaseDate := time.Unix(int64(recording.ReleaseYear), 0)
+	recording.ReleaseYear = releaseDate.Year()
+
+	return recording, nil
+}
+
+func (db *TabloDB) GetRecordings() ([]RecordingRecord, error) {
+	db.log.Println("getting all recordings")
+
+	rows, err := db.database.Query(queries["selectRecordings"])
+	if err != nil {
+		db.log.Println(queries["selectRecordings"])
+		db.log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var recordings []RecordingRecord
+	for rows.Next() {
+		var recording RecordingRecord
+		err = rows.Scan(&recording.RecordingID, &recording.ShowType, &recording.ShowTitle, &recording.Season, &recording.Episode, &recording.AirDate, &recording.EpisodeTitle, &recording.ReleaseYear, &recording.RecordingState, &recording.RecordingDuration, &recording.RecordingSize, &recording.ShowID, &recording.EpisodeID, &recording.ComSkipState, &recording.CallSign, &recording.Teams)
+		if err != nil {
+			db.log.Println(err)
+			return nil, err
+		}
+
+		releaseDate := time.Unix(int64(recording.ReleaseYear), 0)
+		recording.ReleaseYear = releaseDate.Year()
+		recordings = append(recordings, recording)
+	}
+
+	db.log.Printf("%d recordings found\n", len(recordings))
+	return recordings, nil
+}
+
+func (db *TabloDB) GetAutoExportRecordings() ([]RecordingRecord, error) {
+	db.log.Println("getting recordings eligible for automatic export")
+
+	rows, err := db.database.Query(queries["selectAutoExportRecordings"])
+	if err != nil {
+		db.log.Println(queries["selectAutoExportRecordings"])
+		db.log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var recordings []RecordingRecord
+	for rows.Next() {
+		var recording RecordingRecord
+		err = rows.Scan(&recording.RecordingID, &recording.ShowType, &recording.ShowTitle, &recording.Season, &recording.Episode, &recording.AirDate, &recording.EpisodeTitle, &recording.ReleaseYear, &recording.RecordingState, &recording.RecordingDuration, &recording.RecordingSize, &recording.ShowID, &recording.EpisodeID, &recording.ComSkipState, &recording.CallSign, &recording.Teams)
+		if err != nil {
+			db.log.Println(err)
+			return nil, err
+		}
+
+		releaseDate := time.Unix(int64(recording.ReleaseYear), 0)
+		recording.ReleaseYear = releaseDate.Year()
+		recordings = append(recordings, recording)
+	}
+
+	db.log.Printf("%d recordings eligible for automatic export\n", len(recordings))
+	return recordings, nil
+}
+
+func (db *TabloDB) GetExportProgress(queueID int) (ExportProgressRecord, error) {
+	db.log.Printf("getting export progress for queueid %d\n", queueID)
+
+	var progress ExportProgressRecord
+	stmt, err := db.stmt("selectExportProgress")
+	if err != nil {
+		return progress, err
+	}
+	err = stmt.QueryRow(queueID).Scan(&progress.QueueID, &progress.RecordingID, &progress.TempFile, &progress.SegmentsCompleted, &progress.BytesWritten, &progress.Checksum)
+	if err != nil {
+		db.log.Println(err)
+		return progress, notFound(err, fmt.Sprintf("export progress for queueid %d", queueID))
+	}
+
+	return progress, nil
+}
+
+func (db *TabloDB) UpsertExportProgress(progress ExportProgressRecord) error {
+	err := db.exec("upsertExportProgress", progress.QueueID, progress.RecordingID, progress.TempFile, progress.SegmentsCompleted, progress.BytesWritten, progress.Checksum)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *TabloDB) DeleteExportProgress(queueID int) error {
+	db.log.Printf("deleting export progress for queueid %d\n", queueID)
+	err := db.exec("deleteExportProgress", queueID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *TabloDB) PurgeExpiredAirings() error {
+	db.log.Println("Deleting expired airings")
+	now := time.Now().Unix()
+	err := db.exec("deleteExpiredAirings", now)
+	if err != nil {
+		return err
+	}
+	db.log.Println("Expired airings deleted")
+	return nil
+}
+
+func (db *TabloDB) DeleteAiring(airingID int) error {
+	db.log.Printf("deleting airingID %d\n", airingID)
+	err := db.exec("deleteAiringByID", airingID)
+	if err != nil {
+		return err
+	}
+
+	db.log.Println("airing deleted")
+	return err
+}
+
+func (db *TabloDB) UpsertSingleAiring(airing tabloapi.Airing) error {
 	db.log.Printf("updating airing %d\n", airing.ObjectID)
 
-	var showID string
-	var episodeID string
+	var showID int
+	var episodeID any
 	airdate, err := dateStringToInt(airing.AiringDetails.Datetime)
 	if err != nil {
 		db.log.Println(err)
@@ -1391,45 +1732,22 @@ func (db *TabloDB) UpsertSingleAiring(airing tabloapi.Airing) error {
 	}
 
 	if airing.SeriesPath != "" {
-		showID = strings.Split(airing.SeriesPath, "/")[3]
-		episodeID = "'" + stringmanip.SanitizeSql(getEpisodeID(showID, strconv.Itoa(airing.Episode.SeasonNumber), airing.Episode.Number, airdate)) + "'"
+		showID, err = pathID(airing.SeriesPath)
+		episodeID = getEpisodeID(strconv.Itoa(showID), strconv.Itoa(airing.Episode.SeasonNumber), airing.Episode.Number, airdate)
 	} else if airing.MoviePath != "" {
-		showID = strings.Split(airing.MoviePath, "/")[3]
-		episodeID = "null"
+		showID, err = pathID(airing.MoviePath)
 	} else if airing.SportPath != "" {
-		showID = strings.Split(airing.SportPath, "/")[3]
-		episodeID = "'" + stringmanip.SanitizeSql(getEpisodeID(showID, airing.Event.Season, 0, airdate)) + "'"
+		showID, err = pathID(airing.SportPath)
+		episodeID = getEpisodeID(strconv.Itoa(showID), airing.Event.Season, 0, airdate)
 	} else {
-		err := fmt.Errorf("No show path for %d", airing.ObjectID)
-		db.log.Println(err)
-		return err
+		err = fmt.Errorf("No show path for %d", airing.ObjectID)
 	}
-
-	var airingValue strings.Builder
-	airingValue.WriteRune('(')
-	airingValue.WriteString(strconv.Itoa(airing.ObjectID))
-	airingValue.WriteRune(',')
-	airingValue.WriteString(stringmanip.SanitizeSql(showID))
-	airingValue.WriteRune(',')
-	airingValue.WriteString(strconv.Itoa(airdate))
-	airingValue.WriteRune(',')
-	airingValue.WriteString(strconv.Itoa(airing.AiringDetails.Duration))
-	airingValue.WriteRune(',')
-	airingValue.WriteString(strconv.Itoa(airing.AiringDetails.Channel.ObjectID))
-	airingValue.WriteString(",'")
-	airingValue.WriteString(stringmanip.SanitizeSql(airing.Schedule.State))
-	airingValue.WriteString("',")
-	airingValue.WriteString(episodeID) // previously sanitized
-	airingValue.WriteRune(')')
-
-	qryUpsertAiring := fmt.Sprintf(templates["upsertAiring"], airingValue.String())
-	_, err = db.database.Exec(qryUpsertAiring)
-	if err != nil {
-		db.log.Println(qryUpsertAiring)
+	if err != nil {
 		db.log.Println(err)
 		return err
 	}
-	return nil
+
+	return db.exec("upsertAiring", airing.ObjectID, showID, airdate, airing.AiringDetails.Duration, airing.AiringDetails.Channel.ObjectID, airing.Schedule.State, episodeID)
 }
 
 func (db *TabloDB) ResetScheduled() error {
@@ -1492,18 +1810,8 @@ func isOverlapping(c, s conflictRecord) bool {
 	return false
 }
 
-func createConflictValue(c conflictRecord) string {
-	var conflictValue strings.Builder
-	conflictValue.WriteRune('(')
-	conflictValue.WriteString(strconv.Itoa(c.airingID))
-	conflictValue.WriteRune(',')
-	conflictValue.WriteString(strconv.Itoa(c.showID))
-	conflictValue.WriteRune(',')
-	conflictValue.WriteString(strconv.Itoa(c.airDate))
-	conflictValue.WriteRune(',')
-	conflictValue.WriteString(strconv.Itoa(c.endDate))
-	conflictValue.WriteRune(')')
-	return conflictValue.String()
+func conflictRow(c conflictRecord) []any {
+	return []any{c.airingID, c.showID, c.airDate, c.endDate}
 }
 
 func getEpisodeID(showID, season string, episode, airdate int) string {
@@ -1520,6 +1828,124 @@ func getEpisodeID(showID, season string, episode, airdate int) string {
 	return episodeID
 }
 
+// stmt returns statements[name], preparing it the first time it is used
+func (db *TabloDB) stmt(name string) (*sql.Stmt, error) {
+	db.prepared.mu.Lock()
+	defer db.prepared.mu.Unlock()
+
+	stmt, ok := db.prepared.stmts[name]
+	if ok {
+		return stmt, nil
+	}
+
+	stmt, err := db.database.Prepare(statements[name])
+	if err != nil {
+		db.log.Println(statements[name])
+		db.log.Println(err)
+		return nil, err
+	}
+
+	db.prepared.stmts[name] = stmt
+	return stmt, nil
+}
+
+// exec runs statements[name] with args bound to its placeholders
+func (db *TabloDB) exec(name string, args ...any) error {
+	stmt, err := db.stmt(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(args...)
+	if err != nil {
+		db.log.Println(statements[name])
+		db.log.Println(args...)
+		db.log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// execRows runs statements[name] once for each row, all in one transaction so
+// a large upsert is written at once or not at all
+func (db *TabloDB) execRows(name string, rows [][]any) error {
+	stmt, err := db.stmt(name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.database.Begin()
+	if err != nil {
+		db.log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	txStmt := tx.Stmt(stmt)
+	for _, row := range rows {
+		_, err = txStmt.Exec(row...)
+		if err != nil {
+			db.log.Println(statements[name])
+			db.log.Println(row...)
+			db.log.Println(err)
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		db.log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// query runs the statements[name] query with args bound to its placeholders
+func (db *TabloDB) query(name string, args ...any) (*sql.Rows, error) {
+	stmt, err := db.stmt(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		db.log.Println(statements[name])
+		db.log.Println(args...)
+		db.log.Println(err)
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// emptyToNull binds "" as NULL
+func emptyToNull(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// pathID returns the ID at the end of a Tablo path like /guide/series/1234
+func pathID(path string) (int, error) {
+	id, err := strconv.Atoi(strings.Split(path, "/")[3])
+	if err != nil {
+		return 0, fmt.Errorf("strconv.Atoi error in pathID: %v", err)
+	}
+	return id, nil
+}
+
+// notFound adds ErrNotFound to sql.ErrNoRows so callers don't need to know
+// about database/sql
+func notFound(err error, what string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w: %w", what, ErrNotFound, err)
+	}
+	return err
+}
+
 func int64ToTime(i int64) time.Time {
 	return time.Unix(i, 0)
 }
@@ -1557,5 +1983,3 @@ func dateYearToInt(y int) int {
 	date := time.Date(y, time.Month(1), 1, 0, 0, 0, 0, time.Local)
 	return int(date.Unix())
 }
-
-
@@ -1,6 +1,6 @@
 package tablodb
 
-const dbVer = 1
+const dbVer = 11
 
 var queries = map[string]string{
 	// Create entire database:
@@ -18,7 +18,17 @@ CREATE TABLE systemInfo (
   scheduledLastUpdated  INT NOT NULL,
   defaultExportPath     TEXT,
   totalSize             INT,
-  freeSize              INT
+  freeSize              INT,
+  autoExport            INT,
+  verifyTolerance       REAL,
+  deleteAfterExport     INT,
+  seriesTemplate        TEXT,
+  movieTemplate         TEXT,
+  sportTemplate         TEXT,
+  exportWorkers         INT,
+  exportBytesPerSecond  INT,
+  requestTimeout        INT,
+  batchWorkers          INT
 );
 
 -- Create channel table
@@ -175,6 +185,26 @@ CREATE TABLE queue (
   exportPath TEXT NOT NULL
 );
 
+-- Create export hook and queue history tables
+CREATE TABLE exportHook (
+  hookID    INTEGER PRIMARY KEY,
+  showType  TEXT,
+  command   TEXT NOT NULL,
+  onSuspect INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE queueHistory (
+  historyID  INTEGER PRIMARY KEY,
+  queueID    INT NOT NULL,
+  action     TEXT NOT NULL,
+  details    TEXT NOT NULL,
+  exportPath TEXT NOT NULL,
+  result     TEXT NOT NULL,
+  exitStatus INT,
+  output     TEXT,
+  finishedAt INT NOT NULL
+);
+
 -- Create priority table
 CREATE TABLE showPriority (
   showID   INT NOT NULL,
@@ -194,14 +224,60 @@ CREATE TABLE scheduleConflicts (
 
 -- Create exported table
 CREATE TABLE exported (
-  fullPath TEXT NOT NULL PRIMARY KEY
+  fullPath     TEXT NOT NULL PRIMARY KEY,
+  recordingID  INT,
+  verification TEXT,
+  fileSize     INT,
+  fileDuration INT
+);
+
+-- Create deleteAudit table
+CREATE TABLE deleteAudit (
+  auditID     INTEGER PRIMARY KEY,
+  recordingID INT NOT NULL,
+  showID      INT NOT NULL,
+  episodeID   TEXT,
+  showTitle   TEXT NOT NULL,
+  fullPath    TEXT NOT NULL,
+  deletedAt   INT NOT NULL,
+  result      TEXT NOT NULL
 );
 
+-- Create alert table
+CREATE TABLE alert (
+  alertID   INTEGER PRIMARY KEY,
+  alertType TEXT NOT NULL,
+  details   TEXT NOT NULL,
+  message   TEXT NOT NULL,
+  raisedAt  INT NOT NULL,
+  clearedAt INT
+);
+
+-- Only one open alert of each type per details
+CREATE UNIQUE INDEX alertOpen ON alert(alertType, details) WHERE clearedAt IS NULL;
+
 -- Create filter table
 CREATE TABLE showFilter (
   showID INT NOT NULL PRIMARY KEY,
   ignore INT,
   FOREIGN KEY (showID) REFERENCES show(showID) ON DELETE CASCADE
+);
+
+-- Create showAutoExport table
+CREATE TABLE showAutoExport (
+  showID     INT NOT NULL PRIMARY KEY,
+  autoExport INT NOT NULL,
+  FOREIGN KEY (showID) REFERENCES show(showID) ON DELETE CASCADE
+);
+
+-- Create exportProgress table
+CREATE TABLE exportProgress (
+  queueID           INT NOT NULL PRIMARY KEY,
+  recordingID       INT NOT NULL,
+  tempFile          TEXT NOT NULL,
+  segmentsCompleted INT NOT NULL,
+  bytesWritten      INT NOT NULL,
+  checksum          TEXT NOT NULL
 );`,
 	// Select all records from the queue table
 	"selectQueue": `
@@ -226,6 +302,14 @@ FROM
 	"getDefaultExportPath": `
 SELECT
   COALESCE(defaultExportPath, '') as defaultExportPath
+FROM
+  systemInfo;`,
+	// Get the Tablo's identity from systemInfo
+	"getSystemInfo": `
+SELECT
+  serverID,
+  serverName,
+  privateIP
 FROM
   systemInfo;`,
 	// Get dbVer from systemInfo
@@ -265,6 +349,61 @@ SELECT
   fullPath
 FROM
   exported;`,
+	// Select the recordings with an export, wherever it was exported to
+	"selectExportedRecordingIDs": `
+SELECT DISTINCT
+  recordingID
+FROM
+  exported
+WHERE
+  recordingID IS NOT NULL;`,
+	// Select exported files that failed verification
+	"selectSuspectExported": `
+SELECT
+  fullPath
+FROM
+  exported
+WHERE
+  verification = 'suspect';`,
+	// Get verifyTolerance from systemInfo
+	"getVerifyTolerance": `
+SELECT
+  COALESCE(verifyTolerance, 0.05) AS verifyTolerance
+FROM
+  systemInfo;`,
+	// Get export filename templates from systemInfo
+	"getExportTemplates": `
+SELECT
+  COALESCE(seriesTemplate, '') AS seriesTemplate,
+  COALESCE(movieTemplate, '') AS movieTemplate,
+  COALESCE(sportTemplate, '') AS sportTemplate
+FROM
+  systemInfo;`,
+	// Get export concurrency and bandwidth limits from systemInfo
+	"getExportLimits": `
+SELECT
+  COALESCE(exportWorkers, 1) AS exportWorkers,
+  COALESCE(exportBytesPerSecond, 0) AS exportBytesPerSecond
+FROM
+  systemInfo;`,
+	// Get the Tablo request timeout (in seconds) from systemInfo
+	"getRequestTimeout": `
+SELECT
+  COALESCE(requestTimeout, 0) AS requestTimeout
+FROM
+  systemInfo;`,
+	// Get how many batch requests to send to the Tablo at once from systemInfo
+	"getBatchWorkers": `
+SELECT
+  COALESCE(batchWorkers, 0) AS batchWorkers
+FROM
+  systemInfo;`,
+	// Get deleteAfterExport from systemInfo
+	"getDeleteAfterExport": `
+SELECT
+  COALESCE(deleteAfterExport, 0) AS deleteAfterExport
+FROM
+  systemInfo;`,
 	// Select all scheduled airings
 	"selectScheduledAirings": `
 SELECT
@@ -275,18 +414,118 @@ SELECT
   COALESCE(e.episode, 0) AS episode,
   a.airDate,
   COALESCE(e.title, '') AS episodeTitle,
-  COALESCE(s.releaseDate, 0) as releaseDate
+  COALESCE(s.releaseDate, 0) as releaseDate,
+  COALESCE(e.originalAirDate, 0) AS originalAirDate,
+  COALESCE(c.callSign, '') AS callSign,
+  COALESCE((
+    SELECT
+      group_concat(t.team, ' vs ')
+    FROM
+      episodeTeam AS et
+      INNER JOIN team AS t ON et.teamID = t.teamID
+    WHERE
+      et.episodeID = a.episodeID
+  ), '') AS teams
 FROM
   airing AS a
   INNER JOIN show AS s ON a.showID = s.showID
   LEFT JOIN episode AS e ON a.episodeID = e.episodeID
+  LEFT JOIN channel AS c ON a.channelID = c.channelID
 WHERE
   scheduled IN ('scheduled','conflict');`,
+	// Select all recordings
+	"selectRecordings": `
+SELECT
+  r.recordingID,
+  s.showType,
+  s.title AS showTitle,
+  COALESCE(e.season, '') AS season,
+  COALESCE(e.episode, 0) AS episode,
+  r.airDate,
+  COALESCE(e.title, '') AS episodeTitle,
+  COALESCE(s.releaseDate, 0) AS releaseDate,
+  r.recordingState,
+  r.recordingDuration,
+  r.recordingSize,
+  r.showID,
+  COALESCE(r.episodeID, '') AS episodeID,
+  r.comSkipState,
+  COALESCE(c.callSign, '') AS callSign,
+  COALESCE((
+    SELECT
+      group_concat(t.team, ' vs ')
+    FROM
+      episodeTeam AS et
+      INNER JOIN team AS t ON et.teamID = t.teamID
+    WHERE
+      et.episodeID = r.episodeID
+  ), '') AS teams
+FROM
+  recording AS r
+  INNER JOIN show AS s ON r.showID = s.showID
+  LEFT JOIN episode AS e ON r.episodeID = e.episodeID
+  LEFT JOIN channel AS c ON r.channelID = c.channelID
+ORDER BY
+  r.airDate;`,
+	// Select open alerts
+	"selectOpenAlerts": `
+SELECT
+  alertID,
+  alertType,
+  details,
+  message,
+  raisedAt
+FROM
+  alert
+WHERE
+  clearedAt IS NULL
+ORDER BY
+  raisedAt;`,
 	// update scheduled airings to none
 	"updateAiringScheduledToNone": `
 UPDATE airing
 SET scheduled = 'none'
 WHERE scheduled in ('conflict','scheduled');`,
+	// Select finished recordings eligible for automatic export
+	"selectAutoExportRecordings": `
+SELECT
+  r.recordingID,
+  s.showType,
+  s.title AS showTitle,
+  COALESCE(e.season, '') AS season,
+  COALESCE(e.episode, 0) AS episode,
+  r.airDate,
+  COALESCE(e.title, '') AS episodeTitle,
+  COALESCE(s.releaseDate, 0) AS releaseDate,
+  r.recordingState,
+  r.recordingDuration,
+  r.recordingSize,
+  r.showID,
+  COALESCE(r.episodeID, '') AS episodeID,
+  r.comSkipState,
+  COALESCE(c.callSign, '') AS callSign,
+  COALESCE((
+    SELECT
+      group_concat(t.team, ' vs ')
+    FROM
+      episodeTeam AS et
+      INNER JOIN team AS t ON et.teamID = t.teamID
+    WHERE
+      et.episodeID = r.episodeID
+  ), '') AS teams
+FROM
+  recording AS r
+  INNER JOIN show AS s ON r.showID = s.showID
+  LEFT JOIN episode AS e ON r.episodeID = e.episodeID
+  LEFT JOIN channel AS c ON r.channelID = c.channelID
+  LEFT JOIN showAutoExport AS sae ON r.showID = sae.showID
+  LEFT JOIN showAutoExport AS psae ON s.parentShowID = psae.showID
+  CROSS JOIN systemInfo AS si
+WHERE
+  r.recordingState = 'finished'
+  AND COALESCE(sae.autoExport, psae.autoExport, si.autoExport, 1) = 1
+ORDER BY
+  r.airDate ASC;`,
 	// select conflicted shows & priority
 	"selectPriorityConflicts": `
 SELECT
@@ -304,9 +543,134 @@ ORDER BY
   sc.endDate,
   COALESCE(sp.priority, 0),
   sc.airingID;`,
+	// Create a table for the IDs of the recordings still on the Tablo
+	"createTempRecordingID": `
+DROP TABLE IF EXISTS temp.tempRecordingID;
+CREATE TEMP TABLE tempRecordingID (
+  recordingID INT NOT NULL PRIMARY KEY
+);`,
+	// Delete recordings that are not in tempRecordingID
+	"deleteRemovedRecordings": `
+DELETE FROM recording
+WHERE
+  recordingID IN (
+    SELECT
+      r.recordingID
+    FROM
+      recording r
+      LEFT JOIN tempRecordingID t ON r.recordingID = t.recordingID
+    WHERE
+      t.recordingID IS NULL
+  );
+DROP TABLE IF EXISTS temp.tempRecordingID;`,
+}
+
+// upgrades holds the script that moves the database from the previous version
+// to the keyed version
+var upgrades = map[int]string{
+	2: `
+ALTER TABLE systemInfo ADD COLUMN autoExport INT;
+
+CREATE TABLE showAutoExport (
+  showID     INT NOT NULL PRIMARY KEY,
+  autoExport INT NOT NULL,
+  FOREIGN KEY (showID) REFERENCES show(showID) ON DELETE CASCADE
+);
+
+UPDATE systemInfo SET dbVer = 2;`,
+	3: `
+CREATE TABLE exportProgress (
+  queueID           INT NOT NULL PRIMARY KEY,
+  recordingID       INT NOT NULL,
+  tempFile          TEXT NOT NULL,
+  segmentsCompleted INT NOT NULL,
+  bytesWritten      INT NOT NULL,
+  checksum          TEXT NOT NULL
+);
+
+UPDATE systemInfo SET dbVer = 3;`,
+	4: `
+ALTER TABLE systemInfo ADD COLUMN verifyTolerance REAL;
+ALTER TABLE exported ADD COLUMN recordingID INT;
+ALTER TABLE exported ADD COLUMN verification TEXT;
+ALTER TABLE exported ADD COLUMN fileSize INT;
+ALTER TABLE exported ADD COLUMN fileDuration INT;
+
+UPDATE systemInfo SET dbVer = 4;`,
+	5: `
+ALTER TABLE systemInfo ADD COLUMN deleteAfterExport INT;
+
+CREATE TABLE deleteAudit (
+  auditID     INTEGER PRIMARY KEY,
+  recordingID INT NOT NULL,
+  showID      INT NOT NULL,
+  episodeID   TEXT,
+  showTitle   TEXT NOT NULL,
+  fullPath    TEXT NOT NULL,
+  deletedAt   INT NOT NULL,
+  result      TEXT NOT NULL
+);
+
+UPDATE systemInfo SET dbVer = 5;`,
+	6: `
+ALTER TABLE systemInfo ADD COLUMN seriesTemplate TEXT;
+ALTER TABLE systemInfo ADD COLUMN movieTemplate TEXT;
+ALTER TABLE systemInfo ADD COLUMN sportTemplate TEXT;
+
+UPDATE systemInfo SET dbVer = 6;`,
+	7: `
+ALTER TABLE systemInfo ADD COLUMN exportWorkers INT;
+ALTER TABLE systemInfo ADD COLUMN exportBytesPerSecond INT;
+
+UPDATE systemInfo SET dbVer = 7;`,
+	8: `
+CREATE TABLE alert (
+  alertID   INTEGER PRIMARY KEY,
+  alertType TEXT NOT NULL,
+  details   TEXT NOT NULL,
+  message   TEXT NOT NULL,
+  raisedAt  INT NOT NULL,
+  clearedAt INT
+);
+
+-- Only one open alert of each type per details
+CREATE UNIQUE INDEX alertOpen ON alert(alertType, details) WHERE clearedAt IS NULL;
+
+UPDATE systemInfo SET dbVer = 8;`,
+	9: `
+CREATE TABLE exportHook (
+  hookID    INTEGER PRIMARY KEY,
+  showType  TEXT,
+  command   TEXT NOT NULL,
+  onSuspect INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE queueHistory (
+  historyID  INTEGER PRIMARY KEY,
+  queueID    INT NOT NULL,
+  action     TEXT NOT NULL,
+  details    TEXT NOT NULL,
+  exportPath TEXT NOT NULL,
+  result     TEXT NOT NULL,
+  exitStatus INT,
+  output     TEXT,
+  finishedAt INT NOT NULL
+);
+
+UPDATE systemInfo SET dbVer = 9;`,
+	10: `
+ALTER TABLE systemInfo ADD COLUMN requestTimeout INT;
+
+UPDATE systemInfo SET dbVer = 10;`,
+	11: `
+ALTER TABLE systemInfo ADD COLUMN batchWorkers INT;
+
+UPDATE systemInfo SET dbVer = 11;`,
 }
 
-var templates = map[string]string{
+// statements holds the SQL that takes parameters, bound to its ? placeholders
+// when run. Each is prepared the first time it is used and then reused.
+var statements = map[string]string{
 	// Upsert systemInfo
 	"upsertSystemInfo": `
 INSERT INTO systemInfo (
@@ -319,10 +683,10 @@ INSERT INTO systemInfo (
   scheduledLastUpdated
 )
 VALUES (
-  '%s',
-  '%s',
-  '%s',
-  %d,
+  ?,
+  ?,
+  ?,
+  ?,
   0,
   0,
   0
@@ -338,9 +702,9 @@ INSERT INTO queue (
   exportPath
 )
 VALUES (
-  '%s',
-  '%s',
-  '%s'
+  ?,
+  ?,
+  ?
 );`,
 	// Insert queue record with high priority
 	"insertQueuePriority": `
@@ -352,9 +716,9 @@ INSERT INTO queue (
 )
 SELECT
   MIN(queueID) - 1,
-  '%s',
-  '%s',
-  '%s'
+  ?,
+  ?,
+  ?
 FROM queue;`,
 	// Upsert channel
 	"upsertChannel": `
@@ -365,8 +729,13 @@ INSERT INTO channel (
   minor,
   network
 )
-VALUES
-%s
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
 ON CONFLICT DO UPDATE SET
   callSign = excluded.callSign,
   major = excluded.major,
@@ -389,8 +758,21 @@ INSERT INTO show (
   rating,
   stars
 )
-VALUES
-%s
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
 ON CONFLICT DO UPDATE SET
   rule = excluded.rule,
   channelID = excluded.channelID,
@@ -408,8 +790,10 @@ INSERT INTO showGenre (
   showID,
   genre
 )
-VALUES
-  %s
+VALUES (
+  ?,
+  ?
+)
 ON CONFLICT DO NOTHING;`,
 	// Insert showCast
 	"insertShowCastMember": `
@@ -417,8 +801,10 @@ INSERT INTO showCastMember (
   showID,
   castMember
 )
-VALUES
-  %s
+VALUES (
+  ?,
+  ?
+)
 ON CONFLICT DO NOTHING;`,
 	// Upsert showAward
 	"upsertShowAward": `
@@ -430,8 +816,14 @@ INSERT INTO showAward (
   awardYear,
   nominee
 )
-VALUES
-  %s
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
 ON CONFLICT DO UPDATE SET
   won = excluded.won;`,
 	// Insert showDirector
@@ -440,21 +832,25 @@ INSERT INTO showDirector (
   showID,
   director
 )
-VALUES
-  %s
+VALUES (
+  ?,
+  ?
+)
 ON CONFLICT DO NOTHING;`,
 	// Delete queue record
 	"deleteQueueRecord": `
 DELETE FROM queue
-WHERE queueID = %d;`,
+WHERE queueID = ?;`,
 	// Upsert team
 	"upsertTeam": `
 INSERT INTO team (
   teamID,
   team
 )
-VALUES
-%s
+VALUES (
+  ?,
+  ?
+)
 ON CONFLICT DO UPDATE SET
   team = excluded.team;`,
 	// Upsert episode
@@ -470,8 +866,17 @@ INSERT INTO episode (
   originalAirDate,
   homeTeamID
 )
-VALUES
-%s
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
 ON CONFLICT DO UPDATE SET
   showID = excluded.showID,
   title = excluded.title,
@@ -487,8 +892,10 @@ INSERT INTO episodeTeam (
   episodeID,
   teamID
 )
-VALUES
-%s
+VALUES (
+  ?,
+  ?
+)
 ON CONFLICT DO NOTHING;`,
 	// Upsert airing
 	"upsertAiring": `
@@ -501,8 +908,15 @@ INSERT INTO airing (
   scheduled,
   episodeID
 )
-VALUES
-%s
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
 ON CONFLICT DO UPDATE SET
   showID = excluded.showID,
   airDate = excluded.airDate,
@@ -513,15 +927,15 @@ ON CONFLICT DO UPDATE SET
 	// Update guideLastUpdated in systemInfo
 	"updateGuideLastUpdated": `
 UPDATE systemInfo
-SET guideLastUpdated = %d`,
+SET guideLastUpdated = ?`,
 	// Update scheduledLastUpdated in systemInfo
 	"updateScheduledLastUpdated": `
 UPDATE systemInfo
-SET scheduledLastUpdated = %d`,
+SET scheduledLastUpdated = ?`,
 	// Update scheduledLastUpdated in systemInfo
 	"updateRecordingsLastUpdated": `
 UPDATE systemInfo
-SET recordingsLastUpdated = %d`,
+SET recordingsLastUpdated = ?`,
 	// Insert error
 	"upsertRecording": `
 INSERT INTO recording (
@@ -537,8 +951,19 @@ INSERT INTO recording (
   comSkipState,
   episodeID
 )
-VALUES
-%s
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
 ON CONFLICT DO UPDATE SET
   showID = excluded.showID,
   airDate = excluded.airDate,
@@ -569,20 +994,40 @@ INSERT INTO error (
   errorDetails,
   errorDescription
 )
-VALUES
-%s;`,
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+);`,
 	// Update systemInfo
 	"updateSystemInfo": `
 UPDATE systemInfo
 SET
-  serverName = '%s',
-  privateIP = '%s';`,
+  serverName = ?,
+  privateIP = ?;`,
+	// Update privateIP in systemInfo
+	"updatePrivateIP": `
+UPDATE systemInfo
+SET
+  privateIP = ?;`,
 	// Update space in systemInfo
 	"updateSpace": `
 UPDATE systemInfo
 SET
-  totalSize = %d,
-  freeSize = %d;`,
+  totalSize = ?,
+  freeSize = ?;`,
 	// Insert conflicts
 	"insertConflicts": `
 INSERT INTO scheduleConflicts (
@@ -591,19 +1036,23 @@ INSERT INTO scheduleConflicts (
   airDate,
   endDate
 )
-VALUES
-%s;`,
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?
+);`,
 	// Delete exported
 	"deleteExported": `
 DELETE FROM exported
-WHERE fullPath in ('%s');`,
+WHERE fullPath = ?;`,
 	// Insert exported
 	"insertExported": `
 INSERT INTO exported (
   fullPath
 )
 VALUES
-('%s')
+(?)
 ON CONFLICT DO NOTHING;`,
 	// Select query record with specific action
 	"selectQueueRecordByAction": `
@@ -612,37 +1061,274 @@ SELECT
 FROM
   queue
 WHERE
-  action = '%s';`,
+  action = ?;`,
 	// Delete old airings
 	"deleteExpiredAirings": `
 DELETE FROM airing
 WHERE
-  airDate < %d;`,
-	// Delete removed recordings
-	"deleteRemovedRecordings": `
-DROP TABLE IF EXISTS tempRecordingID;
-CREATE TABLE tempRecordingID (
-  recordingID INT NOT NULL PRIMARY KEY
-);
-INSERT INTO tempRecordingID (
+  airDate < ?;`,
+	// Insert the ID of a recording still on the Tablo. The same recording can
+	// be listed twice, so repeats are ignored.
+	"insertTempRecordingID": `
+INSERT OR IGNORE INTO tempRecordingID (
   recordingID
 )
 VALUES
-(%s);
-DELETE FROM recording
-WHERE
-  recordingID IN (
+(?);`,
+	// Delete airing by airingID
+	"deleteAiringByID": `
+DELETE FROM airing
+WHERE airingID = ?;`,
+	// Select recording by recordingID
+	"selectRecordingByID": `
+SELECT
+  r.recordingID,
+  s.showType,
+  s.title AS showTitle,
+  COALESCE(e.season, '') AS season,
+  COALESCE(e.episode, 0) AS episode,
+  r.airDate,
+  COALESCE(e.title, '') AS episodeTitle,
+  COALESCE(s.releaseDate, 0) AS releaseDate,
+  r.recordingState,
+  r.recordingDuration,
+  r.recordingSize,
+  r.showID,
+  COALESCE(r.episodeID, '') AS episodeID,
+  r.comSkipState,
+  COALESCE(c.callSign, '') AS callSign,
+  COALESCE((
     SELECT
-      r.recordingID
+      group_concat(t.team, ' vs ')
     FROM
-      recording r
-      LEFT JOIN tempRecordingID t ON r.recordingID = t.recordingID
+      episodeTeam AS et
+      INNER JOIN team AS t ON et.teamID = t.teamID
     WHERE
-      t.recordingID IS NULL
-  );
-DROP TABLE IF EXISTS tempRecordingID;`,
-	// Delete airing by airingID
-	"deleteAiringByID": `
-DELETE airing
-WHERE airingID IN (%s);`,
+      et.episodeID = r.episodeID
+  ), '') AS teams
+FROM
+  recording AS r
+  INNER JOIN show AS s ON r.showID = s.showID
+  LEFT JOIN episode AS e ON r.episodeID = e.episodeID
+  LEFT JOIN channel AS c ON r.channelID = c.channelID
+WHERE
+  r.recordingID = ?;`,
+	// Select export progress by queueID
+	"selectExportProgress": `
+SELECT
+  queueID,
+  recordingID,
+  tempFile,
+  segmentsCompleted,
+  bytesWritten,
+  checksum
+FROM
+  exportProgress
+WHERE
+  queueID = ?;`,
+	// Upsert export progress
+	"upsertExportProgress": `
+INSERT INTO exportProgress (
+  queueID,
+  recordingID,
+  tempFile,
+  segmentsCompleted,
+  bytesWritten,
+  checksum
+)
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
+ON CONFLICT DO UPDATE SET
+  recordingID = excluded.recordingID,
+  tempFile = excluded.tempFile,
+  segmentsCompleted = excluded.segmentsCompleted,
+  bytesWritten = excluded.bytesWritten,
+  checksum = excluded.checksum;`,
+	// Delete export progress by queueID
+	"deleteExportProgress": `
+DELETE FROM exportProgress
+WHERE queueID = ?;`,
+	// Upsert verified export
+	"upsertExportedVerification": `
+INSERT INTO exported (
+  fullPath,
+  recordingID,
+  verification,
+  fileSize,
+  fileDuration
+)
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
+ON CONFLICT DO UPDATE SET
+  recordingID = excluded.recordingID,
+  verification = excluded.verification,
+  fileSize = excluded.fileSize,
+  fileDuration = excluded.fileDuration;`,
+	// Delete recording by recordingID
+	"deleteRecordingByID": `
+DELETE FROM recording
+WHERE recordingID = ?;`,
+	// Insert deleteAudit
+	"insertDeleteAudit": `
+INSERT INTO deleteAudit (
+  recordingID,
+  showID,
+  episodeID,
+  showTitle,
+  fullPath,
+  deletedAt,
+  result
+)
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+);`,
+	// Select export hooks for a show type, including hooks for every show type
+	"selectExportHooks": `
+SELECT
+  hookID,
+  command,
+  onSuspect
+FROM
+  exportHook
+WHERE
+  COALESCE(showType, '') IN ('', ?)
+ORDER BY
+  hookID;`,
+	// Insert queueHistory
+	"insertQueueHistory": `
+INSERT INTO queueHistory (
+  queueID,
+  action,
+  details,
+  exportPath,
+  result,
+  exitStatus,
+  output,
+  finishedAt
+)
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+);`,
+	// Raise an alert, updating the message of a matching open alert
+	"upsertAlert": `
+INSERT INTO alert (
+  alertType,
+  details,
+  message,
+  raisedAt
+)
+VALUES (
+  ?,
+  ?,
+  ?,
+  ?
+)
+ON CONFLICT (alertType, details) WHERE clearedAt IS NULL DO UPDATE SET
+  message = excluded.message;`,
+	// Clear open alerts by alertType and details
+	"clearAlert": `
+UPDATE alert
+SET
+  clearedAt = ?
+WHERE
+  alertType = ?
+  AND details = ?
+  AND clearedAt IS NULL;`,
+	// Select show metadata by showID
+	"selectShowMetadata": `
+SELECT
+  showID,
+  showType,
+  title,
+  COALESCE(descript, '') AS descript,
+  COALESCE(releaseDate, 0) AS releaseDate,
+  COALESCE(origRunTime, 0) AS origRunTime,
+  COALESCE(rating, '') AS rating
+FROM
+  show
+WHERE
+  showID = ?;`,
+	// Select genres by showID
+	"selectShowGenres": `
+SELECT
+  genre
+FROM
+  showGenre
+WHERE
+  showID = ?
+ORDER BY
+  genre;`,
+	// Select cast members by showID
+	"selectShowCastMembers": `
+SELECT
+  castMember
+FROM
+  showCastMember
+WHERE
+  showID = ?
+ORDER BY
+  rowid;`,
+	// Select directors by showID
+	"selectShowDirectors": `
+SELECT
+  director
+FROM
+  showDirector
+WHERE
+  showID = ?
+ORDER BY
+  rowid;`,
+	// Select awards by showID
+	"selectShowAwards": `
+SELECT
+  won,
+  awardName,
+  awardCategory,
+  awardYear,
+  COALESCE(nominee, '') AS nominee
+FROM
+  showAward
+WHERE
+  showID = ?
+ORDER BY
+  awardYear,
+  awardName,
+  awardCategory;`,
+	// Select episode metadata by episodeID
+	"selectEpisodeMetadata": `
+SELECT
+  episodeID,
+  COALESCE(title, '') AS title,
+  COALESCE(descript, '') AS descript,
+  COALESCE(episode, 0) AS episode,
+  COALESCE(season, '') AS season,
+  COALESCE(originalAirDate, 0) AS originalAirDate
+FROM
+  episode
+WHERE
+  episodeID = ?;`,
 }